@@ -0,0 +1,132 @@
+// Package mqtttest provides an in-memory MQTT client for testing bridges
+// without a broker.
+package mqtttest
+
+import (
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Client implements mqtt.Client, recording what is published and
+// delivering test messages to the subscribed handlers
+type Client struct {
+	mutex         sync.Mutex
+	published     []Message
+	retained      map[string]string
+	subscriptions map[string]mqtt.MessageHandler
+}
+
+// Message implements mqtt.Message
+type Message struct {
+	TopicName    string
+	PayloadBytes []byte
+	IsRetained   bool
+}
+
+func (m Message) Duplicate() bool   { return false }
+func (m Message) Qos() byte         { return 0 }
+func (m Message) Retained() bool    { return m.IsRetained }
+func (m Message) Topic() string     { return m.TopicName }
+func (m Message) MessageID() uint16 { return 0 }
+func (m Message) Payload() []byte   { return m.PayloadBytes }
+func (m Message) Ack()              {}
+
+// NewMessage returns a message for calling handlers directly
+func NewMessage(topic, payload string) Message {
+	return Message{TopicName: topic, PayloadBytes: []byte(payload)}
+}
+
+func NewClient() *Client {
+	return &Client{
+		retained:      make(map[string]string),
+		subscriptions: make(map[string]mqtt.MessageHandler),
+	}
+}
+
+func (c *Client) IsConnected() bool      { return true }
+func (c *Client) IsConnectionOpen() bool { return true }
+func (c *Client) Connect() mqtt.Token    { return &mqtt.DummyToken{} }
+func (c *Client) Disconnect(uint)        {}
+
+func (c *Client) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var data []byte
+	switch p := payload.(type) {
+	case string:
+		data = []byte(p)
+	case []byte:
+		data = p
+	}
+	c.published = append(c.published, Message{TopicName: topic, PayloadBytes: data, IsRetained: retained})
+	if retained {
+		c.retained[topic] = string(data)
+	}
+	return &mqtt.DummyToken{}
+}
+
+func (c *Client) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.subscriptions[topic] = callback
+	return &mqtt.DummyToken{}
+}
+
+func (c *Client) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	for topic := range filters {
+		c.Subscribe(topic, 0, callback)
+	}
+	return &mqtt.DummyToken{}
+}
+
+func (c *Client) Unsubscribe(topics ...string) mqtt.Token {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, topic := range topics {
+		delete(c.subscriptions, topic)
+	}
+	return &mqtt.DummyToken{}
+}
+
+func (c *Client) AddRoute(string, mqtt.MessageHandler) {}
+
+func (c *Client) OptionsReader() mqtt.ClientOptionsReader {
+	return mqtt.ClientOptionsReader{}
+}
+
+// Deliver calls the handler subscribed to filter with a message on topic,
+// panicking if there is no such subscription
+func (c *Client) Deliver(filter, topic, payload string) {
+	c.mutex.Lock()
+	handler, exists := c.subscriptions[filter]
+	c.mutex.Unlock()
+	if !exists {
+		panic("no subscription for " + filter)
+	}
+	handler(c, NewMessage(topic, payload))
+}
+
+// Retained returns the last retained payload of topic and whether any
+// was published
+func (c *Client) Retained(topic string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	payload, exists := c.retained[topic]
+	return payload, exists
+}
+
+// Payloads returns the payloads published to topic, in order
+func (c *Client) Payloads(topic string) []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var payloads []string
+	for _, message := range c.published {
+		if message.TopicName == topic {
+			payloads = append(payloads, string(message.PayloadBytes))
+		}
+	}
+	return payloads
+}
@@ -0,0 +1,48 @@
+package lib
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+// Starts a fake MPD server sending greeting to each connection and
+// answering each command line with the response of respond, which may
+// block to keep a command such as idle pending. Returns its address.
+func newFakeMpdServer(t *testing.T, greeting string, respond func(line string) string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte(greeting + "\n"))
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					if _, err := conn.Write([]byte(respond(scanner.Text()))); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// Starts a fake MPD server answering every command with an ACK, and
+// returns its address
+func newFailingMpdServer(t *testing.T) string {
+	return newFakeMpdServer(t, "OK MPD 0.23.5", func(line string) string {
+		command, _, _ := strings.Cut(line, " ")
+		return "ACK [5@0] {" + command + "} unknown command \"" + command + "\"\n"
+	})
+}
@@ -2,8 +2,14 @@ package lib
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"log/slog"
+	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,18 +21,179 @@ import (
 	"github.com/fhs/gompd/v2/mpd"
 )
 
+// MPDClient and PlaylistWatcher are replaced on reconnect by EventLoop
+// while holding sendMutex, so MQTT handlers must hold sendMutex when
+// using them. Both are nil until the first successful connection.
 type MpdMQTTBridge struct {
 	common.BaseMQTTBridge
 	MPDClient       *mpd.Client
-	PlaylistWatcher mpd.Watcher
+	PlaylistWatcher *MpdWatcher
+	MpdClientConfig MpdClientConfig
 	sendMutex       sync.Mutex
+	playing         bool
+	albumArtCache   albumArtCache
+	albumArtKey     string
+	currentSongFile string
+	lastStatus      playerStatus
 }
 
+// Player status as of the last status update, used to detect when a
+// song has played to its end
+type playerStatus struct {
+	songID   string
+	state    string
+	elapsed  float64
+	duration float64
+	at       time.Time
+}
+
+// A song is considered finished if it stops or changes within this
+// many seconds of its end
+const songEndTolerance = 5.0
+
+func newPlayerStatus(status mpd.Attrs, now time.Time) playerStatus {
+	elapsed, _ := strconv.ParseFloat(status["elapsed"], 64)
+	duration, _ := strconv.ParseFloat(status["duration"], 64)
+	return playerStatus{
+		songID:   status["songid"],
+		state:    status["state"],
+		elapsed:  elapsed,
+		duration: duration,
+		at:       now,
+	}
+}
+
+// Returns true if the song playing in prev has played to its end in next
+func songFinished(prev, next playerStatus) bool {
+	if prev.state != "play" || prev.songID == "" || prev.duration <= 0 {
+		return false
+	}
+	if next.songID == prev.songID && next.state != "stop" {
+		return false
+	}
+	elapsed := prev.elapsed + next.at.Sub(prev.at).Seconds()
+	return elapsed >= prev.duration-songEndTolerance
+}
+
+// Album art per album, evicting the oldest entry when full
+type albumArtCache struct {
+	art  map[string][]byte
+	keys []string
+}
+
+const albumArtCacheSize = 32
+
+func (cache *albumArtCache) get(key string) ([]byte, bool) {
+	art, exists := cache.art[key]
+	return art, exists
+}
+
+func (cache *albumArtCache) put(key string, art []byte) {
+	if cache.art == nil {
+		cache.art = make(map[string][]byte)
+	}
+	if _, exists := cache.art[key]; !exists {
+		if len(cache.keys) >= albumArtCacheSize {
+			delete(cache.art, cache.keys[0])
+			cache.keys = cache.keys[1:]
+		}
+		cache.keys = append(cache.keys, key)
+	}
+	cache.art[key] = art
+}
+
+// Published retained on mpd/currentsong
+type MpdCurrentSong struct {
+	Artist   string  `json:"artist"`
+	Album    string  `json:"album"`
+	Title    string  `json:"title"`
+	File     string  `json:"file"`
+	Duration float64 `json:"duration"`
+}
+
+// Published periodically on mpd/elapsed while playing
+type MpdElapsed struct {
+	Elapsed  float64 `json:"elapsed"`
+	Duration float64 `json:"duration"`
+}
+
+// Published on mpd/error when an MPD command fails. Command is the command
+// topic without the endpoint namespace, such as play/set, and sticker/set
+// for playcount updates.
+type MpdCommandError struct {
+	Command string `json:"command"`
+	Error   string `json:"error"`
+}
+
+// Payload of mpd/queue/move, moving the entry at position From to To
+type MpdQueueMove struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// Payload of mpd/search/req. Type is one of "find", "search", "list" and
+// "lsinfo". Filters are tag/value pairs for find, search and list, Tag
+// is the tag to list and URI the directory for lsinfo. The response is
+// published on mpd/search/res/<id>.
+type MpdSearchRequest struct {
+	ID      string            `json:"id"`
+	Type    string            `json:"type"`
+	Filters map[string]string `json:"filters"`
+	Tag     string            `json:"tag"`
+	URI     string            `json:"uri"`
+	Offset  int               `json:"offset"`
+	Limit   int               `json:"limit"`
+}
+
+type MpdSearchResponse struct {
+	ID      string `json:"id"`
+	Total   int    `json:"total"`
+	Offset  int    `json:"offset"`
+	Results any    `json:"results"`
+	Error   string `json:"error,omitempty"`
+}
+
+const defaultSearchLimit = 100
+
 type MpdClientConfig struct {
 	MpdServer, MpdPassword string
+	// Topic namespace, mpd/<name>/..., or mpd/... if empty
+	Name string
+	// MPD partition to use, default partition if empty
+	Partition string
+	// Interval of elapsed time updates while playing, 0 to disable
+	ElapsedInterval time.Duration
+	// Idle subsystems to watch, empty for all
+	Subsystems []string
+	// Client-to-client channels mirrored on mpd/channel/<channel>/receive
+	Channels []string
+	// Increment the playcount sticker of songs played to their end
+	PlayCount bool
 }
 
-func CreateMPDClient(config MpdClientConfig) (*mpd.Client, *mpd.Watcher, error) {
+// Payload of mpd/sticker/set and mpd/sticker/delete, URI defaults to the
+// current song
+type MpdStickerRequest struct {
+	URI   string `json:"uri"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Parses an endpoint given as name=[password@]address[/partition]
+func ParseMpdEndpoint(endpoint string) (MpdClientConfig, error) {
+	name, address, found := strings.Cut(endpoint, "=")
+	password := ""
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		password, address = address[:i], address[i+1:]
+	}
+	if !found || name == "" || address == "" || strings.Contains(name, "/") {
+		return MpdClientConfig{}, fmt.Errorf("invalid MPD endpoint %q, expected name=[password@]address[/partition]", endpoint)
+	}
+	address, partition, _ := strings.Cut(address, "/")
+	return MpdClientConfig{Name: name, MpdServer: address, MpdPassword: password, Partition: partition}, nil
+}
+
+func CreateMPDClient(config MpdClientConfig) (*mpd.Client, *MpdWatcher, error) {
 	mpdClient, err := mpd.DialAuthenticated("tcp", config.MpdServer, config.MpdPassword)
 	if err != nil {
 		slog.Error("Could not connect to MPD server", "mpdServer", config.MpdServer, "error", err)
@@ -35,7 +202,15 @@ func CreateMPDClient(config MpdClientConfig) (*mpd.Client, *mpd.Watcher, error)
 		slog.Info("Connected to MPD server", "mpdServer", config.MpdServer)
 	}
 
-	watcher, err := mpd.NewWatcher("tcp", config.MpdServer, config.MpdPassword, "player", "output")
+	if config.Partition != "" {
+		err = mpdClient.Partition(config.Partition)
+		if err != nil {
+			slog.Error("Could not switch MPD partition", "mpdServer", config.MpdServer, "partition", config.Partition, "error", err)
+			return mpdClient, nil, err
+		}
+	}
+
+	watcher, err := NewMpdWatcher(config)
 	if err != nil {
 		slog.Error("Could not create MPD watcher", "mpdServer", config.MpdServer, "error", err)
 		return mpdClient, watcher, err
@@ -49,8 +224,13 @@ func NewMpdMQTTBridge(config MpdClientConfig, mqttClient mqtt.Client, topicPrefi
 
 	mpdClient, watcher, err := CreateMPDClient(config)
 	if err != nil {
-		slog.Error("Could not create MPD client", "error", err)
-		return nil, err
+		// EventLoop keeps retrying, so one unavailable endpoint does not
+		// keep the others from starting
+		slog.Error("Could not create MPD client, retrying in event loop", "name", config.Name, "error", err)
+		if mpdClient != nil {
+			mpdClient.Close()
+		}
+		mpdClient, watcher = nil, nil
 	}
 
 	bridge := &MpdMQTTBridge{
@@ -59,21 +239,59 @@ func NewMpdMQTTBridge(config MpdClientConfig, mqttClient mqtt.Client, topicPrefi
 			TopicPrefix: topicPrefix,
 		},
 		MPDClient:       mpdClient,
-		PlaylistWatcher: *watcher,
+		PlaylistWatcher: watcher,
+		MpdClientConfig: config,
+	}
+
+	if mpdClient != nil {
+		bridge.subscribe()
+		time.Sleep(2 * time.Second)
+		bridge.initialize()
 	}
+	return bridge, nil
+}
 
+// Subscribes to the command topics, once connected to MPD as the
+// handlers use MPDClient
+func (bridge *MpdMQTTBridge) subscribe() {
 	funcs := map[string]func(client mqtt.Client, message mqtt.Message){
-		"mpd/output/+/set": bridge.onMpdOutputSet,
-		"mpd/pause/set":    bridge.onMpdPauseSet,
+		bridge.topic("output/+/set"):   bridge.onMpdOutputSet,
+		bridge.topic("pause/set"):      bridge.onMpdPauseSet,
+		bridge.topic("play/set"):       bridge.onMpdPlaySet,
+		bridge.topic("stop/set"):       bridge.triggerHandler("stop/set", func() error { return bridge.MPDClient.Stop() }),
+		bridge.topic("next/set"):       bridge.triggerHandler("next/set", func() error { return bridge.MPDClient.Next() }),
+		bridge.topic("previous/set"):   bridge.triggerHandler("previous/set", func() error { return bridge.MPDClient.Previous() }),
+		bridge.topic("seek/set"):       bridge.onMpdSeek,
+		bridge.topic("seek/change"):    bridge.onMpdSeek,
+		bridge.topic("volume/set"):     bridge.intHandler("volume/set", func(v int) error { return bridge.MPDClient.SetVolume(v) }),
+		bridge.topic("random/set"):     bridge.boolHandler("random/set", func(b bool) error { return bridge.MPDClient.Random(b) }),
+		bridge.topic("repeat/set"):     bridge.boolHandler("repeat/set", func(b bool) error { return bridge.MPDClient.Repeat(b) }),
+		bridge.topic("single/set"):     bridge.boolHandler("single/set", func(b bool) error { return bridge.MPDClient.Single(b) }),
+		bridge.topic("consume/set"):    bridge.boolHandler("consume/set", func(b bool) error { return bridge.MPDClient.Consume(b) }),
+		bridge.topic("crossfade/set"):  bridge.intHandler("crossfade/set", func(v int) error { return bridge.MPDClient.Command("crossfade %d", v).OK() }),
+		bridge.topic("queue/clear"):    bridge.triggerHandler("queue/clear", func() error { return bridge.MPDClient.Clear() }),
+		bridge.topic("queue/add"):      bridge.stringHandler("queue/add", func(uri string) error { return bridge.MPDClient.Add(uri) }),
+		bridge.topic("queue/load"):     bridge.stringHandler("queue/load", func(name string) error { return bridge.MPDClient.PlaylistLoad(name, -1, -1) }),
+		bridge.topic("queue/save"):     bridge.stringHandler("queue/save", func(name string) error { return bridge.MPDClient.PlaylistSave(name) }),
+		bridge.topic("queue/delete"):   bridge.intHandler("queue/delete", func(pos int) error { return bridge.MPDClient.Delete(pos, -1) }),
+		bridge.topic("queue/move"):     bridge.onMpdQueueMove,
+		bridge.topic("search/req"):     bridge.onMpdSearchReq,
+		bridge.topic("channel/+/send"): bridge.onMpdChannelSend,
+		bridge.topic("sticker/set"):    bridge.onMpdStickerReq,
+		bridge.topic("sticker/delete"): bridge.onMpdStickerReq,
 	}
 	for key, function := range funcs {
-		token := mqttClient.Subscribe(prefixify(topicPrefix, key), 0, function)
+		token := bridge.MQTTClient.Subscribe(prefixify(bridge.TopicPrefix, key), 0, function)
 		token.Wait()
 	}
-	time.Sleep(2 * time.Second)
-	bridge.initialize()
+}
 
-	return bridge, nil
+// Returns the topic for the subtopic in the namespace of this endpoint
+func (bridge *MpdMQTTBridge) topic(subtopic string) string {
+	if bridge.MpdClientConfig.Name != "" {
+		return "mpd/" + bridge.MpdClientConfig.Name + "/" + subtopic
+	}
+	return "mpd/" + subtopic
 }
 
 func prefixify(topicPrefix, subtopic string) string {
@@ -88,7 +306,7 @@ func (bridge *MpdMQTTBridge) onMpdOutputSet(client mqtt.Client, message mqtt.Mes
 	bridge.sendMutex.Lock()
 	defer bridge.sendMutex.Unlock()
 
-	re := regexp.MustCompile(`^mpd/output/([^/]+)/set$`)
+	re := regexp.MustCompile(`/output/([^/]+)/set$`)
 	matches := re.FindStringSubmatch(message.Topic())
 	if matches != nil {
 		outputStr := matches[1]
@@ -104,11 +322,12 @@ func (bridge *MpdMQTTBridge) onMpdOutputSet(client mqtt.Client, message mqtt.Mes
 				slog.Error("Could not parse bool", "payload", p, "error", err)
 				return
 			}
-			bridge.PublishStringMQTT("mpd/output/"+outputStr+"/set", "", false)
+			subtopic := "output/" + outputStr + "/set"
+			bridge.PublishStringMQTT(bridge.topic(subtopic), "", false)
 			if enable {
-				bridge.MPDClient.EnableOutput(int(output))
+				bridge.reportError(subtopic, bridge.MPDClient.EnableOutput(int(output)))
 			} else {
-				bridge.MPDClient.DisableOutput(int(output))
+				bridge.reportError(subtopic, bridge.MPDClient.DisableOutput(int(output)))
 			}
 		}
 	}
@@ -123,13 +342,300 @@ func (bridge *MpdMQTTBridge) onMpdPauseSet(client mqtt.Client, message mqtt.Mess
 		slog.Error("Could not parse bool", "payload", message.Payload(), "error", err)
 		return
 	}
-	bridge.PublishStringMQTT("mpd/pause/set", "", false)
-	bridge.MPDClient.Pause(pause)
+	bridge.PublishStringMQTT(bridge.topic("pause/set"), "", false)
+	bridge.reportError("pause/set", bridge.MPDClient.Pause(pause))
+}
+
+// Plays the song at the playlist position given as payload, or resumes
+// at the current position if the payload is not a number
+func (bridge *MpdMQTTBridge) onMpdPlaySet(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	p := string(message.Payload())
+	if p == "" {
+		return
+	}
+	pos, err := strconv.Atoi(p)
+	if err != nil {
+		pos = -1
+	}
+	bridge.PublishStringMQTT(bridge.topic("play/set"), "", false)
+	bridge.reportError("play/set", bridge.MPDClient.Play(pos))
+}
+
+// Seeks within the current song, absolute for mpd/seek/set and
+// relative for mpd/seek/change, with the payload in seconds
+func (bridge *MpdMQTTBridge) onMpdSeek(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	p := string(message.Payload())
+	if p == "" {
+		return
+	}
+	seconds, err := strconv.ParseFloat(p, 64)
+	if err != nil {
+		slog.Error("Could not parse seek seconds", "payload", p, "error", err)
+		return
+	}
+	relative := strings.HasSuffix(message.Topic(), "/seek/change")
+	subtopic := "seek/set"
+	if relative {
+		subtopic = "seek/change"
+	}
+	bridge.PublishStringMQTT(bridge.topic(subtopic), "", false)
+	bridge.reportError(subtopic, bridge.MPDClient.SeekCur(time.Duration(seconds*float64(time.Second)), relative))
+}
+
+// Handler for topics where any non-empty payload triggers the action
+func (bridge *MpdMQTTBridge) triggerHandler(subtopic string, action func() error) func(mqtt.Client, mqtt.Message) {
+	topic := bridge.topic(subtopic)
+	return func(client mqtt.Client, message mqtt.Message) {
+		bridge.sendMutex.Lock()
+		defer bridge.sendMutex.Unlock()
+
+		if len(message.Payload()) == 0 {
+			return
+		}
+		bridge.PublishStringMQTT(topic, "", false)
+		bridge.reportError(subtopic, action())
+	}
+}
+
+func (bridge *MpdMQTTBridge) boolHandler(subtopic string, action func(bool) error) func(mqtt.Client, mqtt.Message) {
+	topic := bridge.topic(subtopic)
+	return func(client mqtt.Client, message mqtt.Message) {
+		bridge.sendMutex.Lock()
+		defer bridge.sendMutex.Unlock()
+
+		p := string(message.Payload())
+		if p == "" {
+			return
+		}
+		value, err := strconv.ParseBool(p)
+		if err != nil {
+			slog.Error("Could not parse bool", "topic", topic, "payload", p, "error", err)
+			return
+		}
+		bridge.PublishStringMQTT(topic, "", false)
+		bridge.reportError(subtopic, action(value))
+	}
+}
+
+func (bridge *MpdMQTTBridge) intHandler(subtopic string, action func(int) error) func(mqtt.Client, mqtt.Message) {
+	topic := bridge.topic(subtopic)
+	return func(client mqtt.Client, message mqtt.Message) {
+		bridge.sendMutex.Lock()
+		defer bridge.sendMutex.Unlock()
+
+		p := string(message.Payload())
+		if p == "" {
+			return
+		}
+		value, err := strconv.Atoi(p)
+		if err != nil {
+			slog.Error("Could not parse int", "topic", topic, "payload", p, "error", err)
+			return
+		}
+		bridge.PublishStringMQTT(topic, "", false)
+		bridge.reportError(subtopic, action(value))
+	}
+}
+
+func (bridge *MpdMQTTBridge) stringHandler(subtopic string, action func(string) error) func(mqtt.Client, mqtt.Message) {
+	topic := bridge.topic(subtopic)
+	return func(client mqtt.Client, message mqtt.Message) {
+		bridge.sendMutex.Lock()
+		defer bridge.sendMutex.Unlock()
+
+		p := string(message.Payload())
+		if p == "" {
+			return
+		}
+		bridge.PublishStringMQTT(topic, "", false)
+		bridge.reportError(subtopic, action(p))
+	}
+}
+
+func (bridge *MpdMQTTBridge) onMpdQueueMove(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	if len(message.Payload()) == 0 {
+		return
+	}
+	var move MpdQueueMove
+	err := json.Unmarshal(message.Payload(), &move)
+	if err != nil {
+		slog.Error("Could not parse queue move", "payload", string(message.Payload()), "error", err)
+		return
+	}
+	bridge.PublishStringMQTT(bridge.topic("queue/move"), "", false)
+	bridge.reportError("queue/move", bridge.MPDClient.Move(move.From, -1, move.To))
+}
+
+func (bridge *MpdMQTTBridge) onMpdChannelSend(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	re := regexp.MustCompile(`/channel/([^/]+)/send$`)
+	matches := re.FindStringSubmatch(message.Topic())
+	if matches != nil {
+		channel := matches[1]
+		p := string(message.Payload())
+		if p != "" {
+			subtopic := "channel/" + channel + "/send"
+			bridge.PublishStringMQTT(bridge.topic(subtopic), "", false)
+			bridge.reportError(subtopic, bridge.MPDClient.Command("sendmessage %s %s", channel, p).OK())
+		}
+	}
+}
+
+func (bridge *MpdMQTTBridge) onMpdStickerReq(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	if len(message.Payload()) == 0 {
+		return
+	}
+	var req MpdStickerRequest
+	err := json.Unmarshal(message.Payload(), &req)
+	if err != nil || req.Name == "" {
+		slog.Error("Could not parse sticker request", "payload", string(message.Payload()), "error", err)
+		return
+	}
+	if req.URI == "" {
+		song, err := bridge.MPDClient.CurrentSong()
+		if err != nil || song["file"] == "" {
+			slog.Error("No current song for sticker request", "error", err)
+			return
+		}
+		req.URI = song["file"]
+	}
+
+	if strings.HasSuffix(message.Topic(), "/sticker/delete") {
+		bridge.PublishStringMQTT(bridge.topic("sticker/delete"), "", false)
+		bridge.reportError("sticker/delete", bridge.MPDClient.StickerDelete(req.URI, req.Name))
+	} else {
+		bridge.PublishStringMQTT(bridge.topic("sticker/set"), "", false)
+		bridge.reportError("sticker/set", bridge.MPDClient.StickerSet(req.URI, req.Name, req.Value))
+	}
+}
+
+func (bridge *MpdMQTTBridge) onMpdSearchReq(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	if len(message.Payload()) == 0 {
+		return
+	}
+	var req MpdSearchRequest
+	err := json.Unmarshal(message.Payload(), &req)
+	if err != nil {
+		slog.Error("Could not parse search request", "payload", string(message.Payload()), "error", err)
+		return
+	}
+	bridge.PublishStringMQTT(bridge.topic("search/req"), "", false)
+
+	if req.Limit <= 0 {
+		req.Limit = defaultSearchLimit
+	}
+	res := MpdSearchResponse{ID: req.ID, Offset: req.Offset}
+	switch strings.ToLower(req.Type) {
+	case "find", "":
+		var songs []mpd.Attrs
+		songs, err = bridge.MPDClient.Find(filterArgs(req.Filters)...)
+		res.Total, res.Results = len(songs), page(songs, req.Offset, req.Limit)
+	case "search":
+		var songs []mpd.Attrs
+		songs, err = bridge.MPDClient.Search(filterArgs(req.Filters)...)
+		res.Total, res.Results = len(songs), page(songs, req.Offset, req.Limit)
+	case "list":
+		var values []string
+		values, err = bridge.MPDClient.List(append([]string{req.Tag}, filterArgs(req.Filters)...)...)
+		res.Total, res.Results = len(values), page(values, req.Offset, req.Limit)
+	case "lsinfo":
+		var entries []mpd.Attrs
+		entries, err = bridge.MPDClient.ListInfo(req.URI)
+		res.Total, res.Results = len(entries), page(entries, req.Offset, req.Limit)
+	default:
+		err = fmt.Errorf("unknown search type %q", req.Type)
+	}
+	if err != nil {
+		slog.Error("Error searching MPD", "request", req, "error", err)
+		res.Error = err.Error()
+	}
+
+	topic := bridge.topic("search/res")
+	if req.ID != "" {
+		topic += "/" + req.ID
+	}
+	bridge.PublishJSONMQTT(topic, res, false)
+}
+
+// Flattens filters into tag/value arguments, sorted by tag
+func filterArgs(filters map[string]string) []string {
+	tags := make([]string, 0, len(filters))
+	for tag := range filters {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	args := make([]string, 0, 2*len(filters))
+	for _, tag := range tags {
+		args = append(args, tag, filters[tag])
+	}
+	return args
+}
+
+func page[T any](items []T, offset, limit int) []T {
+	if offset < 0 || offset >= len(items) {
+		return []T{}
+	}
+	return items[offset:min(offset+limit, len(items))]
+}
+
+func (bridge *MpdMQTTBridge) reportError(command string, err error) {
+	if err != nil {
+		slog.Error("Error executing MPD command", "command", command, "error", err)
+		bridge.PublishJSONMQTT(bridge.topic("error"), MpdCommandError{Command: command, Error: err.Error()}, false)
+	}
 }
 
 func (bridge *MpdMQTTBridge) initialize() {
 	bridge.publishStatus()
+	bridge.publishCurrentSong()
 	bridge.publishOutputs()
+	bridge.publishQueue()
+	bridge.publishPlaylists()
+	bridge.publishStats()
+}
+
+func (bridge *MpdMQTTBridge) publishStats() {
+	stats, err := bridge.MPDClient.Stats()
+	if err != nil {
+		slog.Error("Error retrieving MPD stats", "error", err)
+	} else {
+		bridge.PublishJSONMQTT(bridge.topic("stats"), stats, true)
+	}
+}
+
+func (bridge *MpdMQTTBridge) publishQueue() {
+	queue, err := bridge.MPDClient.PlaylistInfo(-1, -1)
+	if err != nil {
+		slog.Error("Error retrieving MPD queue", "error", err)
+	} else {
+		bridge.PublishJSONMQTT(bridge.topic("queue"), queue, true)
+	}
+}
+
+func (bridge *MpdMQTTBridge) publishPlaylists() {
+	playlists, err := bridge.MPDClient.ListPlaylists()
+	if err != nil {
+		slog.Error("Error retrieving MPD stored playlists", "error", err)
+	} else {
+		bridge.PublishJSONMQTT(bridge.topic("playlists"), playlists, true)
+	}
 }
 
 func (bridge *MpdMQTTBridge) publishStatus() {
@@ -137,8 +643,136 @@ func (bridge *MpdMQTTBridge) publishStatus() {
 	if err != nil {
 		slog.Error("Error retrieving MPD status", "error", err)
 	} else {
-		bridge.PublishJSONMQTT("mpd/status", status, false)
+		bridge.playing = status["state"] == "play"
+		bridge.PublishJSONMQTT(bridge.topic("status"), status, false)
+
+		next := newPlayerStatus(status, time.Now())
+		if bridge.MpdClientConfig.PlayCount && songFinished(bridge.lastStatus, next) {
+			bridge.incrementPlayCount(bridge.currentSongFile)
+		}
+		bridge.lastStatus = next
+	}
+}
+
+func (bridge *MpdMQTTBridge) incrementPlayCount(uri string) {
+	if uri == "" {
+		return
+	}
+	count := 0
+	sticker, err := bridge.MPDClient.StickerGet(uri, "playcount")
+	if err == nil {
+		count, _ = strconv.Atoi(sticker.Value)
+	}
+	slog.Debug("Incrementing playcount", "uri", uri, "playcount", count+1)
+	bridge.reportError("sticker/set", bridge.MPDClient.StickerSet(uri, "playcount", strconv.Itoa(count+1)))
+}
+
+func (bridge *MpdMQTTBridge) publishStickers() {
+	stickers := make(map[string]string)
+	if bridge.currentSongFile != "" {
+		list, err := bridge.MPDClient.StickerList(bridge.currentSongFile)
+		if err != nil {
+			slog.Debug("Could not retrieve MPD stickers", "uri", bridge.currentSongFile, "error", err)
+		}
+		for _, sticker := range list {
+			stickers[sticker.Name] = sticker.Value
+		}
 	}
+	bridge.PublishJSONMQTT(bridge.topic("currentsong/stickers"), stickers, true)
+}
+
+func (bridge *MpdMQTTBridge) publishCurrentSong() {
+	song, err := bridge.MPDClient.CurrentSong()
+	if err != nil {
+		slog.Error("Error retrieving MPD current song", "error", err)
+		return
+	}
+	duration, _ := strconv.ParseFloat(song["duration"], 64)
+	bridge.PublishJSONMQTT(bridge.topic("currentsong"), MpdCurrentSong{
+		Artist:   song["Artist"],
+		Album:    song["Album"],
+		Title:    song["Title"],
+		File:     song["file"],
+		Duration: duration,
+	}, true)
+	bridge.currentSongFile = song["file"]
+	bridge.publishAlbumArt(song)
+	bridge.publishStickers()
+}
+
+// Identifies the album of a song, falling back to its directory
+func albumKey(song mpd.Attrs) string {
+	if song["Album"] != "" {
+		artist := song["AlbumArtist"]
+		if artist == "" {
+			artist = song["Artist"]
+		}
+		return artist + "\x00" + song["Album"]
+	}
+	return path.Dir(song["file"])
+}
+
+func (bridge *MpdMQTTBridge) publishAlbumArt(song mpd.Attrs) {
+	key := ""
+	if song["file"] != "" {
+		key = albumKey(song)
+	}
+	if key == bridge.albumArtKey {
+		return
+	}
+	bridge.albumArtKey = key
+
+	var art []byte
+	if key != "" {
+		var exists bool
+		art, exists = bridge.albumArtCache.get(key)
+		if !exists {
+			art = bridge.fetchAlbumArt(song["file"])
+			if art != nil {
+				bridge.albumArtCache.put(key, art)
+			}
+		}
+	}
+
+	hash := ""
+	if len(art) > 0 {
+		sum := sha256.Sum256(art)
+		hash = hex.EncodeToString(sum[:])
+	}
+	bridge.PublishBytesMQTT(bridge.topic("currentsong/albumart"), art, true)
+	bridge.PublishStringMQTT(bridge.topic("currentsong/albumart/hash"), hash, true)
+}
+
+// Fetches the cover from the song directory, or else the picture
+// embedded in the song. Returns nil if there is none.
+func (bridge *MpdMQTTBridge) fetchAlbumArt(uri string) []byte {
+	art, err := bridge.MPDClient.AlbumArt(uri)
+	if err == nil && len(art) > 0 {
+		return art
+	}
+	slog.Debug("No album art in directory", "uri", uri, "error", err)
+
+	art, err = bridge.MPDClient.ReadPicture(uri)
+	if err == nil && len(art) > 0 {
+		return art
+	}
+	slog.Debug("No embedded album art", "uri", uri, "error", err)
+	return nil
+}
+
+func (bridge *MpdMQTTBridge) publishElapsed() {
+	status, err := bridge.MPDClient.Status()
+	if err != nil {
+		slog.Error("Error retrieving MPD status", "error", err)
+		return
+	}
+	bridge.playing = status["state"] == "play"
+	if !bridge.playing {
+		return
+	}
+	elapsed, _ := strconv.ParseFloat(status["elapsed"], 64)
+	duration, _ := strconv.ParseFloat(status["duration"], 64)
+	bridge.PublishJSONMQTT(bridge.topic("elapsed"), MpdElapsed{Elapsed: elapsed, Duration: duration}, false)
 }
 
 func (bridge *MpdMQTTBridge) publishOutputs() {
@@ -146,37 +780,135 @@ func (bridge *MpdMQTTBridge) publishOutputs() {
 	if err != nil {
 		slog.Error("Error retrieving MPD outputs", "error", err)
 	} else {
-		bridge.PublishJSONMQTT("mpd/outputs", outputs, false)
+		bridge.PublishJSONMQTT(bridge.topic("outputs"), outputs, false)
+	}
+}
+
+// Publishes the state affected by a change in the given idle subsystem,
+// see https://mpd.readthedocs.io/en/latest/protocol.html#command-idle
+func (bridge *MpdMQTTBridge) handleSubsystemEvent(subsystem string) {
+	switch subsystem {
+	case "player":
+		bridge.publishStatus()
+		bridge.publishCurrentSong()
+	case "mixer", "options", "update":
+		bridge.publishStatus()
+	case "output":
+		bridge.publishOutputs()
+	case "playlist":
+		bridge.publishQueue()
+	case "stored_playlist":
+		bridge.publishPlaylists()
+	case "database":
+		bridge.publishStats()
+	case "sticker":
+		bridge.publishStickers()
 	}
+	bridge.PublishStringMQTT(bridge.topic("event"), subsystem, false)
 }
 
+const (
+	pingInterval        = 10 * time.Second
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = time.Minute
+)
+
 func (bridge *MpdMQTTBridge) EventLoop(ctx context.Context) {
-	for subsystem := range bridge.PlaylistWatcher.Event {
-		slog.Debug("Event received", "subsystem", subsystem)
-		if subsystem == "player" {
-			bridge.publishStatus()
-		} else if subsystem == "output" {
-			bridge.publishOutputs()
+	if bridge.MPDClient == nil {
+		bridge.reconnect(ctx)
+		if ctx.Err() != nil {
+			slog.Info("Closing down MpdMQTTBridge event loop")
+			return
 		}
 	}
-}
 
-func (bridge *MpdMQTTBridge) DetectReconnectMPDClient(config MpdClientConfig) {
+	var elapsedTick <-chan time.Time
+	if bridge.MpdClientConfig.ElapsedInterval > 0 {
+		ticker := time.NewTicker(bridge.MpdClientConfig.ElapsedInterval)
+		defer ticker.Stop()
+		elapsedTick = ticker.C
+	}
+	pingTicker := time.NewTicker(pingInterval)
+	defer pingTicker.Stop()
+
 	for {
-		time.Sleep(10 * time.Second)
-		if bridge.MPDClient != nil {
+		select {
+		case <-ctx.Done():
+			slog.Info("Closing down MpdMQTTBridge event loop")
+			return
+		case subsystem := <-bridge.PlaylistWatcher.Event:
+			slog.Debug("Event received", "name", bridge.MpdClientConfig.Name, "subsystem", subsystem)
+			bridge.handleSubsystemEvent(subsystem)
+		case m := <-bridge.PlaylistWatcher.Message:
+			slog.Debug("Channel message received", "name", bridge.MpdClientConfig.Name, "channel", m.Channel)
+			bridge.PublishStringMQTT(bridge.topic("channel/"+m.Channel+"/receive"), m.Message, false)
+		case err := <-bridge.PlaylistWatcher.Error:
+			slog.Error("MPD watcher error, reconnecting", "name", bridge.MpdClientConfig.Name, "error", err)
+			bridge.reconnect(ctx)
+		case <-pingTicker.C:
+			bridge.sendMutex.Lock()
 			err := bridge.MPDClient.Ping()
+			bridge.sendMutex.Unlock()
 			if err != nil {
-				slog.Error("Ping error, reconnecting", "error", err)
-				mpdClient, watcher, err := CreateMPDClient(config)
-				if err == nil {
-					bridge.MPDClient = mpdClient
-					bridge.PlaylistWatcher = *watcher
-					slog.Error("Reconnected")
-				} else {
-					slog.Error("Ping when reconnecting", "error", err)
-				}
+				slog.Error("Ping error, reconnecting", "name", bridge.MpdClientConfig.Name, "error", err)
+				bridge.reconnect(ctx)
+			}
+		case <-elapsedTick:
+			if bridge.playing {
+				bridge.publishElapsed()
+			}
+		}
+	}
+}
+
+// Replaces the MPD client and watcher with new connections, or connects
+// if not connected at startup, retrying with backoff until connected or
+// ctx is done, and then republishes all state.
+func (bridge *MpdMQTTBridge) reconnect(ctx context.Context) {
+	backoff := minReconnectBackoff
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		mpdClient, watcher, err := CreateMPDClient(bridge.MpdClientConfig)
+		if err == nil {
+			bridge.sendMutex.Lock()
+			oldClient, oldWatcher := bridge.MPDClient, bridge.PlaylistWatcher
+			bridge.MPDClient = mpdClient
+			bridge.PlaylistWatcher = watcher
+			bridge.sendMutex.Unlock()
+
+			slog.Info("Connected to MPD server", "name", bridge.MpdClientConfig.Name, "mpdServer", bridge.MpdClientConfig.MpdServer)
+			if oldClient == nil {
+				// Not connected at startup
+				bridge.subscribe()
+			} else {
+				oldWatcher.Close()
+				// Closing may block on a dead connection
+				go oldClient.Close()
 			}
+			bridge.albumArtKey = ""
+			bridge.initialize()
+			return
 		}
+		if mpdClient != nil {
+			mpdClient.Close()
+		}
+
+		backoff = min(2*backoff, maxReconnectBackoff)
+		slog.Error("Could not reconnect to MPD server", "name", bridge.MpdClientConfig.Name, "error", err, "retryIn", backoff)
+	}
+}
+
+func (bridge *MpdMQTTBridge) Close() {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	if bridge.MPDClient != nil {
+		bridge.PlaylistWatcher.Close()
+		bridge.MPDClient.Close()
 	}
 }
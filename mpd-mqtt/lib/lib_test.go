@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	common "github.com/claes/mqtt-bridges/common"
+	"github.com/claes/mqtt-bridges/common/mqtttest"
+	"github.com/fhs/gompd/v2/mpd"
+)
+
+func TestPage(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e"}
+	tests := []struct {
+		offset, limit int
+		expected      []string
+	}{
+		{0, 2, []string{"a", "b"}},
+		{3, 10, []string{"d", "e"}},
+		{5, 2, []string{}},
+		{-1, 2, []string{}},
+	}
+	for _, tt := range tests {
+		result := page(items, tt.offset, tt.limit)
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("page(%d, %d) = %v, expected %v", tt.offset, tt.limit, result, tt.expected)
+		}
+	}
+}
+
+func TestFilterArgs(t *testing.T) {
+	args := filterArgs(map[string]string{"artist": "X", "album": "Y"})
+	expected := []string{"album", "Y", "artist", "X"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("filterArgs = %v, expected %v", args, expected)
+	}
+}
+
+func TestAlbumKey(t *testing.T) {
+	a := albumKey(mpd.Attrs{"file": "a/1.flac", "Artist": "X", "Album": "Y"})
+	b := albumKey(mpd.Attrs{"file": "b/2.flac", "AlbumArtist": "X", "Artist": "Z", "Album": "Y"})
+	if a != b {
+		t.Errorf("Expected same album key, got %q and %q", a, b)
+	}
+	if key := albumKey(mpd.Attrs{"file": "a/1.flac"}); key != "a" {
+		t.Errorf("Expected directory as album key, got %q", key)
+	}
+}
+
+func TestParseMpdEndpoint(t *testing.T) {
+	config, err := ParseMpdEndpoint("kitchen=kitchen.local:6600")
+	if err != nil || config.Name != "kitchen" || config.MpdServer != "kitchen.local:6600" || config.Partition != "" {
+		t.Errorf("Unexpected endpoint %+v, error %v", config, err)
+	}
+
+	config, err = ParseMpdEndpoint("office=server:6600/office")
+	if err != nil || config.Name != "office" || config.MpdServer != "server:6600" || config.Partition != "office" {
+		t.Errorf("Unexpected endpoint %+v, error %v", config, err)
+	}
+
+	config, err = ParseMpdEndpoint("office=p@ss@server:6600/office")
+	if err != nil || config.MpdPassword != "p@ss" || config.MpdServer != "server:6600" || config.Partition != "office" {
+		t.Errorf("Unexpected endpoint %+v, error %v", config, err)
+	}
+
+	for _, endpoint := range []string{"server:6600", "=server:6600", "a/b=server:6600", "kitchen=", "kitchen=secret@"} {
+		if _, err := ParseMpdEndpoint(endpoint); err == nil {
+			t.Errorf("Expected error for %q", endpoint)
+		}
+	}
+}
+
+func TestSongFinished(t *testing.T) {
+	start := time.Now()
+	playing := playerStatus{songID: "1", state: "play", elapsed: 170, duration: 180, at: start}
+
+	tests := []struct {
+		name     string
+		prev     playerStatus
+		next     playerStatus
+		expected bool
+	}{
+		{"Next song at end", playing, playerStatus{songID: "2", state: "play", at: start.Add(10 * time.Second)}, true},
+		{"Stopped at end", playing, playerStatus{songID: "1", state: "stop", at: start.Add(9 * time.Second)}, true},
+		{"Skipped early", playing, playerStatus{songID: "2", state: "play", at: start.Add(2 * time.Second)}, false},
+		{"Same song", playing, playerStatus{songID: "1", state: "play", at: start.Add(10 * time.Second)}, false},
+		{"Was paused", playerStatus{songID: "1", state: "pause", elapsed: 179, duration: 180, at: start},
+			playerStatus{songID: "2", state: "play", at: start.Add(time.Second)}, false},
+		{"No previous status", playerStatus{}, playerStatus{songID: "1", state: "play", at: start}, false},
+	}
+	for _, tt := range tests {
+		if result := songFinished(tt.prev, tt.next); result != tt.expected {
+			t.Errorf("%s: songFinished = %v, expected %v", tt.name, result, tt.expected)
+		}
+	}
+}
+
+func TestReportErrorCommand(t *testing.T) {
+	mpdClient, err := mpd.Dial("tcp", newFailingMpdServer(t))
+	if err != nil {
+		t.Fatalf("Could not connect to fake MPD server: %v", err)
+	}
+	defer mpdClient.Close()
+	mqttClient := mqtttest.NewClient()
+	bridge := &MpdMQTTBridge{
+		BaseMQTTBridge:  common.BaseMQTTBridge{MQTTClient: mqttClient},
+		MPDClient:       mpdClient,
+		MpdClientConfig: MpdClientConfig{Name: "kitchen"},
+	}
+	bridge.subscribe()
+
+	// Factory and hand-written handlers both report the command topic
+	// without the endpoint namespace
+	mqttClient.Deliver("mpd/kitchen/volume/set", "mpd/kitchen/volume/set", "50")
+	mqttClient.Deliver("mpd/kitchen/play/set", "mpd/kitchen/play/set", "3")
+	mqttClient.Deliver("mpd/kitchen/seek/change", "mpd/kitchen/seek/change", "10")
+
+	var commands []string
+	for _, payload := range mqttClient.Payloads("mpd/kitchen/error") {
+		var commandError MpdCommandError
+		if err := json.Unmarshal([]byte(payload), &commandError); err != nil {
+			t.Fatalf("Could not unmarshal error %q: %v", payload, err)
+		}
+		if commandError.Error == "" {
+			t.Errorf("Missing error message in %q", payload)
+		}
+		commands = append(commands, commandError.Command)
+	}
+	expected := []string{"volume/set", "play/set", "seek/change"}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("Unexpected commands %q, expected %q", commands, expected)
+	}
+}
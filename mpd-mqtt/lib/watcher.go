@@ -0,0 +1,196 @@
+package lib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MpdWatcher is a minimal MPD idle client. Unlike mpd.Watcher it owns its
+// connection, so it can select a partition and subscribe to channels
+// before idling, and Close always unblocks a pending idle, even on a dead
+// connection.
+type MpdWatcher struct {
+	Event   chan string
+	Error   chan error
+	Message chan MpdChannelMessage
+
+	conn       net.Conn
+	reader     *bufio.Reader
+	subsystems []string
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// A message received on a subscribed MPD channel
+type MpdChannelMessage struct {
+	Channel string
+	Message string
+}
+
+const dialTimeout = 10 * time.Second
+
+func NewMpdWatcher(config MpdClientConfig) (*MpdWatcher, error) {
+	conn, err := net.DialTimeout("tcp", config.MpdServer, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	subsystems := config.Subsystems
+	if len(config.Channels) > 0 && len(subsystems) > 0 && !slices.Contains(subsystems, "message") {
+		subsystems = append(slices.Clone(subsystems), "message")
+	}
+	w := &MpdWatcher{
+		Event:      make(chan string),
+		Error:      make(chan error),
+		Message:    make(chan MpdChannelMessage),
+		conn:       conn,
+		reader:     bufio.NewReader(conn),
+		subsystems: subsystems,
+		done:       make(chan struct{}),
+	}
+
+	greeting, err := w.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "OK MPD ") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected MPD greeting %q", greeting)
+	}
+	if config.MpdPassword != "" {
+		if _, err = w.request("password", config.MpdPassword); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if config.Partition != "" {
+		if _, err = w.request("partition", config.Partition); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	for _, channel := range config.Channels {
+		if _, err = w.request("subscribe", channel); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	go w.watch()
+	return w, nil
+}
+
+func (w *MpdWatcher) watch() {
+	for {
+		response, err := w.request("idle", w.subsystems...)
+		if err != nil {
+			select {
+			case w.Error <- err:
+			case <-w.done:
+			}
+			return
+		}
+		for _, pair := range response {
+			if pair[0] != "changed" {
+				continue
+			}
+			if pair[1] == "message" && !w.readMessages() {
+				return
+			}
+			select {
+			case w.Event <- pair[1]:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// Reads pending channel messages and sends them on Message, returns
+// false if the watcher should stop
+func (w *MpdWatcher) readMessages() bool {
+	response, err := w.request("readmessages")
+	if err != nil {
+		select {
+		case w.Error <- err:
+		case <-w.done:
+		}
+		return false
+	}
+	channel := ""
+	for _, pair := range response {
+		switch pair[0] {
+		case "channel":
+			channel = pair[1]
+		case "message":
+			select {
+			case w.Message <- MpdChannelMessage{Channel: channel, Message: pair[1]}:
+			case <-w.done:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (w *MpdWatcher) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.done)
+		err = w.conn.Close()
+	})
+	return err
+}
+
+func (w *MpdWatcher) readLine() (string, error) {
+	line, err := w.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+// Sends a command and returns the key/value pairs of the response
+func (w *MpdWatcher) request(command string, args ...string) ([][2]string, error) {
+	var sb strings.Builder
+	sb.WriteString(command)
+	for _, arg := range args {
+		sb.WriteString(" ")
+		sb.WriteString(quoteArg(arg))
+	}
+	sb.WriteString("\n")
+	if _, err := w.conn.Write([]byte(sb.String())); err != nil {
+		return nil, err
+	}
+
+	var response [][2]string
+	for {
+		line, err := w.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == "OK" {
+			return response, nil
+		}
+		if strings.HasPrefix(line, "ACK ") {
+			return nil, errors.New(line)
+		}
+		key, value, found := strings.Cut(line, ": ")
+		if !found {
+			return nil, fmt.Errorf("could not parse MPD response line %q", line)
+		}
+		response = append(response, [2]string{key, value})
+	}
+}
+
+func quoteArg(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Responds OK to commands other than idle, which is answered with the
+// responses sent on idle
+func idleResponder(idle chan string) func(line string) string {
+	return func(line string) string {
+		if strings.HasPrefix(line, "idle") {
+			return <-idle
+		}
+		return "OK\n"
+	}
+}
+
+func TestMpdWatcherBadGreeting(t *testing.T) {
+	address := newFakeMpdServer(t, "HELLO", idleResponder(nil))
+	if _, err := NewMpdWatcher(MpdClientConfig{MpdServer: address}); err == nil {
+		t.Error("Expected error for bad greeting")
+	}
+}
+
+func TestMpdWatcherSetupAck(t *testing.T) {
+	for _, command := range []string{"partition", "subscribe"} {
+		address := newFakeMpdServer(t, "OK MPD 0.23.5", func(line string) string {
+			if strings.HasPrefix(line, command+" ") {
+				return "ACK [50@0] {" + command + "} failed\n"
+			}
+			return "OK\n"
+		})
+		_, err := NewMpdWatcher(MpdClientConfig{MpdServer: address, Partition: "office", Channels: []string{"chat"}})
+		if err == nil || !strings.Contains(err.Error(), "{"+command+"}") {
+			t.Errorf("Expected %s ACK, got %v", command, err)
+		}
+	}
+}
+
+func TestMpdWatcherEvents(t *testing.T) {
+	idle := make(chan string, 1)
+	address := newFakeMpdServer(t, "OK MPD 0.23.5", func(line string) string {
+		if line == "readmessages" {
+			return "channel: chat\nmessage: hello\nchannel: other\nmessage: hi\nOK\n"
+		}
+		return idleResponder(idle)(line)
+	})
+	watcher, err := NewMpdWatcher(MpdClientConfig{MpdServer: address, Channels: []string{"chat", "other"}})
+	if err != nil {
+		t.Fatalf("Could not create watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	idle <- "changed: player\nchanged: mixer\nOK\n"
+	for _, expected := range []string{"player", "mixer"} {
+		select {
+		case event := <-watcher.Event:
+			if event != expected {
+				t.Errorf("Expected event %q, got %q", expected, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("No %s event", expected)
+		}
+	}
+
+	idle <- "changed: message\nOK\n"
+	for _, expected := range []MpdChannelMessage{{"chat", "hello"}, {"other", "hi"}} {
+		select {
+		case message := <-watcher.Message:
+			if message != expected {
+				t.Errorf("Expected message %+v, got %+v", expected, message)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("No message %+v", expected)
+		}
+	}
+	select {
+	case event := <-watcher.Event:
+		if event != "message" {
+			t.Errorf("Expected message event, got %q", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No message event")
+	}
+}
+
+func TestMpdWatcherCloseDuringIdle(t *testing.T) {
+	idle := make(chan string)
+	t.Cleanup(func() { close(idle) })
+	address := newFakeMpdServer(t, "OK MPD 0.23.5", idleResponder(idle))
+	watcher, err := NewMpdWatcher(MpdClientConfig{MpdServer: address})
+	if err != nil {
+		t.Fatalf("Could not create watcher: %v", err)
+	}
+	if !watching(t, true) {
+		t.Fatal("Watcher not started")
+	}
+
+	watcher.Close()
+	if watching(t, false) {
+		t.Error("Watcher still running after Close")
+	}
+}
+
+// Waits up to a second for a watch goroutine to be running or not
+// running, returns whether one is running
+func watching(t *testing.T, running bool) bool {
+	t.Helper()
+	buf := make([]byte, 1<<20)
+	deadline := time.Now().Add(time.Second)
+	for {
+		n := runtime.Stack(buf, true)
+		found := strings.Contains(string(buf[:n]), "(*MpdWatcher).watch(")
+		if found == running || time.Now().After(deadline) {
+			return found
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
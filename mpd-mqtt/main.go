@@ -7,6 +7,8 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
+	"time"
 
 	common "github.com/claes/mqtt-bridges/common"
 
@@ -18,15 +20,31 @@ var (
 	mpdPassword *string
 	mqttBroker  *string
 	topicPrefix *string
+	elapsed     *int
+	subsystems  *string
+	channels    *string
+	playCount   *bool
+	endpoints   []lib.MpdClientConfig
 	help        *bool
 	debug       *bool
 )
 
 func init() {
 	mpdServer = flag.String("mpd-address", "localhost:6600", "MPD Server address and port")
-	mpdPassword = flag.String("mpd-password", "", "MPD password (optional)")
+	mpdPassword = flag.String("mpd-password", "", "MPD password (optional), default for endpoints without their own password")
+	flag.Func("mpd-endpoint", "Named MPD endpoint as name=[password@]address[/partition], published under mpd/<name>/ (repeatable, overrides -mpd-address)", func(s string) error {
+		endpoint, err := lib.ParseMpdEndpoint(s)
+		if err == nil {
+			endpoints = append(endpoints, endpoint)
+		}
+		return err
+	})
 	mqttBroker = flag.String("broker", "tcp://localhost:1883", "MQTT broker URL")
 	topicPrefix = flag.String("topicPrefix", "", "MQTT topic prefix")
+	subsystems = flag.String("subsystems", "", "Comma separated MPD idle subsystems to watch, empty for all")
+	channels = flag.String("channels", "", "Comma separated MPD client-to-client channels to mirror")
+	playCount = flag.Bool("playcount", false, "Increment the playcount sticker of songs played to their end")
+	elapsed = flag.Int("elapsed-interval", 0, "Seconds between elapsed time updates while playing, 0 to disable")
 
 	help = flag.Bool("help", false, "Print help")
 	debug = flag.Bool("debug", false, "Debug logging")
@@ -46,7 +64,9 @@ func main() {
 		os.Exit(0)
 	}
 
-	mpdClientConfig := lib.MpdClientConfig{MpdServer: *mpdServer, MpdPassword: *mpdPassword}
+	if len(endpoints) == 0 {
+		endpoints = []lib.MpdClientConfig{{MpdServer: *mpdServer}}
+	}
 
 	mqttClient, err := common.CreateMQTTClient(*mqttBroker)
 	if err != nil {
@@ -54,9 +74,29 @@ func main() {
 		os.Exit(1)
 	}
 
-	bridge, err := lib.NewMpdMQTTBridge(mpdClientConfig, mqttClient, *topicPrefix)
-	if err != nil {
-		slog.Error("Error creating MPD-MQTT bridge", "error", err)
+	var bridges []*lib.MpdMQTTBridge
+	for _, mpdClientConfig := range endpoints {
+		if mpdClientConfig.MpdPassword == "" {
+			mpdClientConfig.MpdPassword = *mpdPassword
+		}
+		mpdClientConfig.ElapsedInterval = time.Duration(*elapsed) * time.Second
+		mpdClientConfig.PlayCount = *playCount
+		if *subsystems != "" {
+			mpdClientConfig.Subsystems = strings.Split(*subsystems, ",")
+		}
+		if *channels != "" {
+			mpdClientConfig.Channels = strings.Split(*channels, ",")
+		}
+
+		bridge, err := lib.NewMpdMQTTBridge(mpdClientConfig, mqttClient, *topicPrefix)
+		if err != nil {
+			slog.Error("Error creating MPD-MQTT bridge", "error", err, "name", mpdClientConfig.Name)
+			continue
+		}
+		bridges = append(bridges, bridge)
+	}
+	if len(bridges) == 0 {
+		slog.Error("No MPD endpoint could be started")
 		os.Exit(1)
 	}
 
@@ -65,14 +105,15 @@ func main() {
 
 	fmt.Printf("Started\n")
 
-	go func() {
-		bridge.DetectReconnectMPDClient(mpdClientConfig)
-	}()
-
-	ctx := context.TODO()
-	go bridge.EventLoop(ctx)
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, bridge := range bridges {
+		go bridge.EventLoop(ctx)
+	}
 	<-c
-	bridge.PlaylistWatcher.Close()
+	cancel()
+	for _, bridge := range bridges {
+		bridge.Close()
+	}
 	fmt.Printf("Shut down\n")
 
 	os.Exit(0)
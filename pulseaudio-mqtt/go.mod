@@ -3,12 +3,12 @@ module github.com/claes/mqtt-bridges/pulseaudio-mqtt
 go 1.22.8
 
 require (
+	github.com/claes/mqtt-bridges/common v0.0.0-20241218194001-0e0f35dcc1d1
 	github.com/eclipse/paho.mqtt.golang v1.5.0
 	github.com/jfreymuth/pulse v0.1.1-0.20221101213618-75628dabd933
 )
 
 require (
-	github.com/claes/mqtt-bridges/common v0.0.0-20241218194001-0e0f35dcc1d1 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
 	golang.org/x/net v0.27.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
@@ -3,6 +3,7 @@ package lib
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"regexp"
 	"strconv"
@@ -43,6 +44,7 @@ type PulseAudioSinkInput struct {
 	ClientIndex    uint32
 	SinkIndex      uint32
 	Mute           bool
+	ChannelVolumes []uint32
 
 	Properties map[string]string
 }
@@ -79,10 +81,16 @@ type PulseAudioPort struct {
 	Description string
 }
 
+// Payload of pulseaudio/sinkinput/req. Command is one of movesink, setvolume,
+// changevolume, setmute and kill. The sink inputs are addressed by
+// SinkInputIndex, or by Application matching their application.name property.
 type SinkInputReq struct {
 	Command        string
 	SinkInputIndex uint32
+	Application    string
 	SinkName       string
+	Volume         *float32
+	Mute           *bool
 }
 
 type DetectedChanges struct {
@@ -109,13 +117,20 @@ func (d DetectedChanges) AnyChanged() bool {
 
 type PulseaudioMQTTBridge struct {
 	common.BaseMQTTBridge
-	PulseClient     *PulseClient
-	PulseAudioState PulseAudioState
-	sendMutex       sync.Mutex
+	PulseClient       *PulseClient
+	PulseClientConfig PulseClientConfig
+	PulseAudioState   PulseAudioState
+	sendMutex         sync.Mutex
+
+	routingMutex     sync.Mutex
+	routingRules     []routingRule
+	routedSinkInputs map[uint32]bool
 }
 
 type PulseClientConfig struct {
 	PulseServerAddress string
+	// Rules routing new sink inputs, until replaced by pulseaudio/routing/rules
+	RoutingRules []RoutingRule
 }
 
 func CreatePulseClient(config PulseClientConfig) (*PulseClient, error) {
@@ -131,6 +146,12 @@ func CreatePulseClient(config PulseClientConfig) (*PulseClient, error) {
 
 func NewPulseaudioMQTTBridge(config PulseClientConfig, mqttClient mqtt.Client, topicPrefix string) (*PulseaudioMQTTBridge, error) {
 
+	routingRules, err := compileRoutingRules(config.RoutingRules)
+	if err != nil {
+		slog.Error("Invalid routing rules", "error", err)
+		return nil, err
+	}
+
 	pulseClient, err := CreatePulseClient(config)
 	if err != nil {
 		slog.Error("Error while initializing pulseclient", "error", err, "config", config)
@@ -142,7 +163,10 @@ func NewPulseaudioMQTTBridge(config PulseClientConfig, mqttClient mqtt.Client, t
 			MQTTClient:  mqttClient,
 			TopicPrefix: topicPrefix,
 		},
-		PulseClient: pulseClient,
+		PulseClient:       pulseClient,
+		PulseClientConfig: config,
+		routingRules:      routingRules,
+		routedSinkInputs:  make(map[uint32]bool),
 		PulseAudioState: PulseAudioState{
 			PulseAudioSink{},
 			PulseAudioSource{},
@@ -162,6 +186,14 @@ func NewPulseaudioMQTTBridge(config PulseClientConfig, mqttClient mqtt.Client, t
 		"pulseaudio/volume/change":     bridge.onVolumeChange,
 		"pulseaudio/initialize":        bridge.onInitialize,
 		"pulseaudio/sinkinput/req":     bridge.onSinkInputReq,
+
+		"pulseaudio/sink/+/volume/set":      bridge.onDeviceVolumeSet,
+		"pulseaudio/sink/+/volume/change":   bridge.onDeviceVolumeChange,
+		"pulseaudio/sink/+/mute/set":        bridge.onDeviceMuteSet,
+		"pulseaudio/source/+/volume/set":    bridge.onDeviceVolumeSet,
+		"pulseaudio/source/+/volume/change": bridge.onDeviceVolumeChange,
+		"pulseaudio/source/+/mute/set":      bridge.onDeviceMuteSet,
+		"pulseaudio/routing/rules":          bridge.onRoutingRules,
 	}
 	for key, function := range funcs {
 		token := mqttClient.Subscribe(common.Prefixify(topicPrefix, key), 0, function)
@@ -215,23 +247,82 @@ func (bridge *PulseaudioMQTTBridge) onSinkInputReq(client mqtt.Client, message m
 			slog.Error("Error unmarshaling sink input command", "error", err, "payload", string(message.Payload()))
 			return
 		}
+		bridge.PublishStringMQTT("pulseaudio/sinkinput/req", "", false)
+		err = validateSinkInputReq(sinkInputReq)
+		if err != nil {
+			slog.Error("Invalid sink input command", "error", err, "payload", string(message.Payload()))
+			return
+		}
 
-		if strings.EqualFold(sinkInputReq.Command, "movesink") {
-			sinkName := string(message.Payload())
-			if sinkName != "" {
-				bridge.PublishStringMQTT("pulseaudio/sinkinput/req", "", false)
-				err := bridge.PulseClient.protoClient.Request(&proto.MoveSinkInput{
-					SinkInputIndex: sinkInputReq.SinkInputIndex, DeviceIndex: proto.Undefined, DeviceName: sinkInputReq.SinkName}, nil)
+		sinkInputs, err := bridge.PulseClient.ListSinkInputs()
+		if err != nil {
+			slog.Error("Could not retrieve sink inputs", "error", err)
+			return
+		}
+		sinkInputs = matchSinkInputs(sinkInputs, sinkInputReq)
+		if len(sinkInputs) == 0 {
+			slog.Error("No matching sink input", "sinkInputIndex", sinkInputReq.SinkInputIndex, "application", sinkInputReq.Application)
+			return
+		}
 
-				if err != nil {
-					slog.Error("Could not set card profile", "error", err)
-					return
-				}
+		for _, sinkInput := range sinkInputs {
+			switch strings.ToLower(sinkInputReq.Command) {
+			case "movesink":
+				err = bridge.PulseClient.protoClient.Request(&proto.MoveSinkInput{
+					SinkInputIndex: sinkInput.SinkInputIndex(), DeviceIndex: proto.Undefined, DeviceName: sinkInputReq.SinkName}, nil)
+			case "setvolume":
+				err = bridge.PulseClient.SetSinkInputVolume(sinkInput, *sinkInputReq.Volume)
+			case "changevolume":
+				err = bridge.PulseClient.ChangeSinkInputVolume(sinkInput, *sinkInputReq.Volume)
+			case "setmute":
+				err = bridge.PulseClient.protoClient.Request(&proto.SetSinkInputMute{
+					SinkInputIndex: sinkInput.SinkInputIndex(), Mute: *sinkInputReq.Mute}, nil)
+			case "kill":
+				err = bridge.PulseClient.protoClient.Request(&proto.KillSinkInput{SinkInputIndex: sinkInput.SinkInputIndex()}, nil)
+			default:
+				slog.Error("Unknown sink input command", "command", sinkInputReq.Command)
+				return
+			}
+			if err != nil {
+				slog.Error("Could not execute sink input command", "error", err, "command", sinkInputReq.Command,
+					"sinkInputIndex", sinkInput.SinkInputIndex())
 			}
 		}
 	}
 }
 
+// Checks that a request has the field its command requires, so that a
+// missing volume or mute is not taken as 0 or false
+func validateSinkInputReq(req SinkInputReq) error {
+	switch strings.ToLower(req.Command) {
+	case "setvolume", "changevolume":
+		if req.Volume == nil {
+			return fmt.Errorf("%s requires Volume", req.Command)
+		}
+	case "setmute":
+		if req.Mute == nil {
+			return fmt.Errorf("%s requires Mute", req.Command)
+		}
+	}
+	return nil
+}
+
+// Returns the sink inputs addressed by a request, by application name if
+// given and otherwise by index
+func matchSinkInputs(sinkInputs []*SinkInput, req SinkInputReq) []*SinkInput {
+	var matched []*SinkInput
+	for _, sinkInput := range sinkInputs {
+		if req.Application != "" {
+			if sinkInput.Property("application.name") == req.Application {
+				matched = append(matched, sinkInput)
+			}
+		} else if sinkInput.SinkInputIndex() == req.SinkInputIndex {
+			matched = append(matched, sinkInput)
+		}
+	}
+	return matched
+}
+
 func (bridge *PulseaudioMQTTBridge) onMuteSet(client mqtt.Client, message mqtt.Message) {
 	bridge.sendMutex.Lock()
 	defer bridge.sendMutex.Unlock()
@@ -304,6 +395,102 @@ func (bridge *PulseaudioMQTTBridge) onVolumeChange(client mqtt.Client, message m
 	}
 }
 
+var deviceCommandTopic = regexp.MustCompile(`pulseaudio/(sink|source)/([^/]+)/(volume/set|volume/change|mute/set)$`)
+
+// Returns the device kind, sink or source, and the device name of a
+// pulseaudio/<kind>/<name>/<command> message, clearing the command topic
+func (bridge *PulseaudioMQTTBridge) deviceCommand(message mqtt.Message) (string, string, bool) {
+	matches := deviceCommandTopic.FindStringSubmatch(message.Topic())
+	if matches == nil || len(message.Payload()) == 0 {
+		return "", "", false
+	}
+	kind, name, command := matches[1], matches[2], matches[3]
+	bridge.PublishStringMQTT("pulseaudio/"+kind+"/"+name+"/"+command, "", false)
+	return kind, name, true
+}
+
+func (bridge *PulseaudioMQTTBridge) setDeviceVolume(kind, name string, volume float32, relative bool) error {
+	if kind == "source" {
+		source, err := bridge.PulseClient.SourceByID(name)
+		if err != nil {
+			return err
+		}
+		if relative {
+			return bridge.PulseClient.ChangeSourceVolume(source, volume)
+		}
+		return bridge.PulseClient.SetSourceVolume(source, volume)
+	}
+	sink, err := bridge.PulseClient.SinkByID(name)
+	if err != nil {
+		return err
+	}
+	if relative {
+		return bridge.PulseClient.ChangeSinkVolume(sink, volume)
+	}
+	return bridge.PulseClient.SetSinkVolume(sink, volume)
+}
+
+func (bridge *PulseaudioMQTTBridge) onDeviceVolumeSet(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	kind, name, ok := bridge.deviceCommand(message)
+	if !ok {
+		return
+	}
+	volume, err := strconv.ParseFloat(string(message.Payload()), 32)
+	if err != nil {
+		slog.Error("Could not parse float", "payload", message.Payload())
+		return
+	}
+	err = bridge.setDeviceVolume(kind, name, float32(volume), false)
+	if err != nil {
+		slog.Error("Could not set volume", "error", err, "kind", kind, "name", name)
+	}
+}
+
+func (bridge *PulseaudioMQTTBridge) onDeviceVolumeChange(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	kind, name, ok := bridge.deviceCommand(message)
+	if !ok {
+		return
+	}
+	change, err := strconv.ParseFloat(string(message.Payload()), 32)
+	if err != nil {
+		slog.Error("Could not parse float", "payload", message.Payload())
+		return
+	}
+	err = bridge.setDeviceVolume(kind, name, float32(change), true)
+	if err != nil {
+		slog.Error("Could not change volume", "error", err, "kind", kind, "name", name)
+	}
+}
+
+func (bridge *PulseaudioMQTTBridge) onDeviceMuteSet(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	kind, name, ok := bridge.deviceCommand(message)
+	if !ok {
+		return
+	}
+	mute, err := strconv.ParseBool(string(message.Payload()))
+	if err != nil {
+		slog.Error("Could not parse bool", "messagePayload", message.Payload())
+		return
+	}
+	if kind == "source" {
+		err = bridge.PulseClient.protoClient.Request(&proto.SetSourceMute{SourceIndex: proto.Undefined, SourceName: name, Mute: mute}, nil)
+	} else {
+		err = bridge.PulseClient.protoClient.Request(&proto.SetSinkMute{SinkIndex: proto.Undefined, SinkName: name, Mute: mute}, nil)
+	}
+	if err != nil {
+		slog.Error("Could not set mute", "error", err, "mute", mute, "kind", kind, "name", name)
+	}
+}
+
 func CalculateIncrease(current, percent, max uint32) uint32 {
 	increment := (current * percent) / 100
 	if increment == 0 && percent > 0 {
@@ -352,19 +539,8 @@ func (bridge *PulseaudioMQTTBridge) EventLoop(ctx context.Context) {
 		proto.EventRemove: make(chan proto.SubscriptionEventType, 1),
 	}
 
-	bridge.PulseClient.protoClient.Callback = func(msg interface{}) {
-		switch msg := msg.(type) {
-		case *proto.SubscribeEvent:
-			if ch, ok := eventChannels[msg.Event.GetType()]; ok {
-				select {
-				case ch <- msg.Event:
-				default:
-				}
-			}
-		default:
-			slog.Info("Pulse unknown event received", "evt", msg)
-		}
-	}
+	routing := make(chan struct{}, 1)
+	bridge.PulseClient.protoClient.Callback = subscriptionCallback(eventChannels, routing)
 
 	err := bridge.PulseClient.protoClient.Request(&proto.Subscribe{Mask: proto.SubscriptionMaskAll}, nil)
 	if err != nil {
@@ -372,11 +548,17 @@ func (bridge *PulseaudioMQTTBridge) EventLoop(ctx context.Context) {
 		return
 	}
 
+	// Inputs playing before the bridge started may have been placed
+	// deliberately, only route those created from now on
+	bridge.routeNewSinkInputs(false)
+
 	for {
 		select {
 		case <-ctx.Done():
 			slog.Info("Closing down PulseaudioMQTTBridge event loop")
 			return
+		case <-routing:
+			bridge.routeNewSinkInputs(true)
 		case event := <-eventChannels[proto.EventNew]:
 			slog.Debug("Event new", "event", event)
 		case event := <-eventChannels[proto.EventRemove]:
@@ -425,6 +607,34 @@ func (bridge *PulseaudioMQTTBridge) EventLoop(ctx context.Context) {
 	}
 }
 
+// Returns the pulse callback passing subscription events on to the
+// channel for their type, dropping events while one is already pending.
+// New sink inputs trigger routing on a separate channel so that they are
+// never dropped behind other events. Pending triggers can be coalesced
+// since routing looks at all sink inputs.
+func subscriptionCallback(eventChannels map[proto.SubscriptionEventType]chan proto.SubscriptionEventType,
+	routing chan struct{}) func(msg interface{}) {
+	return func(msg interface{}) {
+		switch msg := msg.(type) {
+		case *proto.SubscribeEvent:
+			if msg.Event.GetType() == proto.EventNew && msg.Event.GetFacility() == proto.EventSinkSinkInput {
+				select {
+				case routing <- struct{}{}:
+				default:
+				}
+			}
+			if ch, ok := eventChannels[msg.Event.GetType()]; ok {
+				select {
+				case ch <- msg.Event:
+				default:
+				}
+			}
+		default:
+			slog.Info("Pulse unknown event received", "evt", msg)
+		}
+	}
+}
+
 func (bridge *PulseaudioMQTTBridge) publishState() {
 	bridge.publishStateGranular(DetectedChanges{
 		defaultSinkChanged:   true,
@@ -549,6 +759,7 @@ func (bridge *PulseaudioMQTTBridge) checkUpdateSinkInputs() (bool, error) {
 			SinkInputIndex: sinkInput.info.SinkInputIndex,
 			SinkIndex:      sinkInput.info.SinkIndex,
 			Mute:           sinkInput.info.Muted,
+			ChannelVolumes: []uint32(sinkInput.info.ChannelVolumes),
 			Properties:     props})
 	}
 
@@ -679,9 +890,18 @@ func (p *PulseAudioSinkInput) Equals(other *PulseAudioSinkInput) bool {
 	if p.MediaName != other.MediaName ||
 		p.SinkInputIndex != other.SinkInputIndex ||
 		p.ClientIndex != other.ClientIndex ||
-		p.SinkIndex != other.SinkIndex {
+		p.SinkIndex != other.SinkIndex ||
+		p.Mute != other.Mute {
 		return false
 	}
+	if len(p.ChannelVolumes) != len(other.ChannelVolumes) {
+		return false
+	}
+	for i := range p.ChannelVolumes {
+		if p.ChannelVolumes[i] != other.ChannelVolumes[i] {
+			return false
+		}
+	}
 	if len(p.Properties) != len(other.Properties) {
 		return false
 	}
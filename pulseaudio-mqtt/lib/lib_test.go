@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func testSinkInput(index uint32, application string) *SinkInput {
+	return &SinkInput{info: proto.GetSinkInputInfoReply{
+		SinkInputIndex: index,
+		Properties:     proto.PropList{"application.name": proto.PropListString(application)},
+	}}
+}
+
+func TestMatchSinkInputs(t *testing.T) {
+	sinkInputs := []*SinkInput{
+		testSinkInput(0, "Spotify"),
+		testSinkInput(3, "Firefox"),
+		testSinkInput(7, "Spotify"),
+	}
+
+	tests := []struct {
+		name     string
+		req      SinkInputReq
+		expected []uint32
+	}{
+		{"By index", SinkInputReq{SinkInputIndex: 3}, []uint32{3}},
+		{"By index zero", SinkInputReq{SinkInputIndex: 0}, []uint32{0}},
+		{"By application", SinkInputReq{Application: "Spotify", SinkInputIndex: 3}, []uint32{0, 7}},
+		{"Unknown index", SinkInputReq{SinkInputIndex: 5}, nil},
+		{"Unknown application", SinkInputReq{Application: "MPD"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var indexes []uint32
+			for _, sinkInput := range matchSinkInputs(sinkInputs, tt.req) {
+				indexes = append(indexes, sinkInput.SinkInputIndex())
+			}
+			if len(indexes) != len(tt.expected) {
+				t.Fatalf("matchSinkInputs = %v; want %v", indexes, tt.expected)
+			}
+			for i := range indexes {
+				if indexes[i] != tt.expected[i] {
+					t.Errorf("matchSinkInputs = %v; want %v", indexes, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSinkInputReq(t *testing.T) {
+	tests := []struct {
+		payload string
+		valid   bool
+	}{
+		{`{"Command": "setvolume", "SinkInputIndex": 1, "Volume": 0.5}`, true},
+		{`{"Command": "setvolume", "SinkInputIndex": 1}`, false},
+		{`{"Command": "changevolume", "SinkInputIndex": 1, "Volume": -0.1}`, true},
+		{`{"Command": "changevolume", "SinkInputIndex": 1}`, false},
+		{`{"Command": "setmute", "SinkInputIndex": 1, "Mute": false}`, true},
+		{`{"Command": "setmute", "SinkInputIndex": 1}`, false},
+		{`{"Command": "kill", "SinkInputIndex": 1}`, true},
+	}
+	for _, tt := range tests {
+		var req SinkInputReq
+		if err := json.Unmarshal([]byte(tt.payload), &req); err != nil {
+			t.Fatalf("Could not parse %s: %v", tt.payload, err)
+		}
+		if err := validateSinkInputReq(req); (err == nil) != tt.valid {
+			t.Errorf("validateSinkInputReq(%s) = %v; want valid %v", tt.payload, err, tt.valid)
+		}
+	}
+}
+
+func TestSinkInputEquals(t *testing.T) {
+	a := PulseAudioSinkInput{SinkInputIndex: 1, ChannelVolumes: []uint32{65536, 65536}}
+	b := PulseAudioSinkInput{SinkInputIndex: 1, ChannelVolumes: []uint32{65536, 65536}}
+	if !a.Equals(&b) {
+		t.Errorf("Expected equal sink inputs")
+	}
+	b.ChannelVolumes = []uint32{65536, 32768}
+	if a.Equals(&b) {
+		t.Errorf("Expected volume change to be detected")
+	}
+	b.ChannelVolumes = a.ChannelVolumes
+	b.Mute = true
+	if a.Equals(&b) {
+		t.Errorf("Expected mute change to be detected")
+	}
+}
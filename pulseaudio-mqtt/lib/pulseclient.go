@@ -7,6 +7,7 @@ import (
 	"net"
 	"os"
 	"path"
+	"strings"
 	"sync"
 
 	// Note depedency on commit 75628dabd933dc15bd44e6945e5ef93723937388
@@ -203,6 +204,16 @@ func (s *Sink) SinkIndex() uint32 {
 	return s.info.SinkIndex
 }
 
+// SinkInputIndex returns the sink input index.
+func (s *SinkInput) SinkInputIndex() uint32 {
+	return s.info.SinkInputIndex
+}
+
+// Property returns a property of the sink input, such as application.name
+func (s *SinkInput) Property(key string) string {
+	return strings.TrimRight(string(s.info.Properties[key]), "\u0000")
+}
+
 // A Source is an input device.
 type Source struct {
 	info proto.GetSourceInfoReply
@@ -325,63 +336,71 @@ func computeChange(before uint32, change int32, max, min uint32) uint32 {
 	}
 }
 
-// SetSinkVolume sets volume of the chnnels.
-// 1.0 means maximum volume and the sink may support software boosted value larger than 1.0.
-// Number of the arguments should be matched to the number of the channels.
+// Returns the channel volumes to set. 1.0 means 100% and values larger than 1.0 are
+// software boosted. Number of the arguments should be matched to the number of the channels.
 // If only one argument is given, volume of all channels will be set to it.
-func (c *PulseClient) SetSinkVolume(s *Sink, volume ...float32) error {
+func absoluteVolumes(current proto.ChannelVolumes, volume ...float32) (proto.ChannelVolumes, error) {
 	var cvol proto.ChannelVolumes
 	switch len(volume) {
 	case 1:
 		v, err := ratioToVolume(float64(volume[0]))
 		if err != nil {
-			return err
+			return nil, err
 		}
-		for range s.info.ChannelVolumes {
+		for range current {
 			cvol = append(cvol, v)
 		}
-	case len(s.info.ChannelVolumes):
+	case len(current):
 		for _, vRatio := range volume {
 			v, err := ratioToVolume(float64(vRatio))
 			if err != nil {
-				return err
+				return nil, err
 			}
 			cvol = append(cvol, v)
 		}
 	default:
-		return errors.New("invalid volume length")
+		return nil, errors.New("invalid volume length")
 	}
-	return c.protoClient.Request(&proto.SetSinkVolume{
-		SinkIndex:      s.info.SinkIndex,
-		ChannelVolumes: cvol,
-	}, &SetSinkVolumeReply{})
+	return cvol, nil
 }
 
-// ChangeSinkVolume sets a relative volume adjustment
-func (c *PulseClient) ChangeSinkVolume(s *Sink, volume ...float32) error {
+// Returns the channel volumes after a relative adjustment of current
+func relativeVolumes(current proto.ChannelVolumes, volume ...float32) (proto.ChannelVolumes, error) {
 	var cvol proto.ChannelVolumes
 	switch len(volume) {
 	case 1:
 		v, err := ratioToVolumeSigned(float64(volume[0]))
 		if err != nil {
-			return err
+			return nil, err
 		}
-		for _, curVolume := range s.info.ChannelVolumes {
+		for _, curVolume := range current {
 			newVolume := computeChange(curVolume, v, 0xFFFFFFFF, 0)
 			cvol = append(cvol, newVolume)
 		}
-	case len(s.info.ChannelVolumes):
+	case len(current):
 		for i, vRatio := range volume {
 			v, err := ratioToVolumeSigned(float64(vRatio))
 			if err != nil {
-				return err
+				return nil, err
 			}
-			curVolume := s.info.ChannelVolumes[i]
+			curVolume := current[i]
 			newVolume := computeChange(curVolume, v, 0xFFFFFFFF, 0)
 			cvol = append(cvol, newVolume)
 		}
 	default:
-		return errors.New("invalid volume length")
+		return nil, errors.New("invalid volume length")
+	}
+	return cvol, nil
+}
+
+// SetSinkVolume sets volume of the chnnels.
+// 1.0 means maximum volume and the sink may support software boosted value larger than 1.0.
+// Number of the arguments should be matched to the number of the channels.
+// If only one argument is given, volume of all channels will be set to it.
+func (c *PulseClient) SetSinkVolume(s *Sink, volume ...float32) error {
+	cvol, err := absoluteVolumes(s.info.ChannelVolumes, volume...)
+	if err != nil {
+		return err
 	}
 	return c.protoClient.Request(&proto.SetSinkVolume{
 		SinkIndex:      s.info.SinkIndex,
@@ -389,6 +408,72 @@ func (c *PulseClient) ChangeSinkVolume(s *Sink, volume ...float32) error {
 	}, &SetSinkVolumeReply{})
 }
 
+// ChangeSinkVolume sets a relative volume adjustment
+func (c *PulseClient) ChangeSinkVolume(s *Sink, volume ...float32) error {
+	cvol, err := relativeVolumes(s.info.ChannelVolumes, volume...)
+	if err != nil {
+		return err
+	}
+	return c.protoClient.Request(&proto.SetSinkVolume{
+		SinkIndex:      s.info.SinkIndex,
+		ChannelVolumes: cvol,
+	}, &SetSinkVolumeReply{})
+}
+
+// SetSinkInputVolume sets volume of the channels, see SetSinkVolume.
+func (c *PulseClient) SetSinkInputVolume(s *SinkInput, volume ...float32) error {
+	if !s.info.VolumeWritable {
+		return errors.New("sink input volume is not writable")
+	}
+	cvol, err := absoluteVolumes(s.info.ChannelVolumes, volume...)
+	if err != nil {
+		return err
+	}
+	return c.protoClient.Request(&proto.SetSinkInputVolume{
+		SinkInputIndex: s.info.SinkInputIndex,
+		ChannelVolumes: cvol,
+	}, nil)
+}
+
+// ChangeSinkInputVolume sets a relative volume adjustment
+func (c *PulseClient) ChangeSinkInputVolume(s *SinkInput, volume ...float32) error {
+	if !s.info.VolumeWritable {
+		return errors.New("sink input volume is not writable")
+	}
+	cvol, err := relativeVolumes(s.info.ChannelVolumes, volume...)
+	if err != nil {
+		return err
+	}
+	return c.protoClient.Request(&proto.SetSinkInputVolume{
+		SinkInputIndex: s.info.SinkInputIndex,
+		ChannelVolumes: cvol,
+	}, nil)
+}
+
+// SetSourceVolume sets volume of the channels, see SetSinkVolume.
+func (c *PulseClient) SetSourceVolume(s *Source, volume ...float32) error {
+	cvol, err := absoluteVolumes(s.info.ChannelVolumes, volume...)
+	if err != nil {
+		return err
+	}
+	return c.protoClient.Request(&proto.SetSourceVolume{
+		SourceIndex:    s.info.SourceIndex,
+		ChannelVolumes: cvol,
+	}, &SetSourceVolumeReply{})
+}
+
+// ChangeSourceVolume sets a relative volume adjustment
+func (c *PulseClient) ChangeSourceVolume(s *Source, volume ...float32) error {
+	cvol, err := relativeVolumes(s.info.ChannelVolumes, volume...)
+	if err != nil {
+		return err
+	}
+	return c.protoClient.Request(&proto.SetSourceVolume{
+		SourceIndex:    s.info.SourceIndex,
+		ChannelVolumes: cvol,
+	}, &SetSourceVolumeReply{})
+}
+
 type SetCardProfile struct{}
 
 func (*SetCardProfile) command() uint32 { return proto.OpSetCardProfile }
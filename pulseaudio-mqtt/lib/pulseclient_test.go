@@ -1,7 +1,10 @@
 package lib
 
 import (
+	"reflect"
 	"testing"
+
+	"github.com/jfreymuth/pulse/proto"
 )
 
 func TestComputeChange(t *testing.T) {
@@ -104,3 +107,35 @@ func TestComputeChange(t *testing.T) {
 		})
 	}
 }
+
+func TestAbsoluteVolumes(t *testing.T) {
+	current := proto.ChannelVolumes{1000, 2000}
+
+	cvol, err := absoluteVolumes(current, 0.5)
+	if err != nil || !reflect.DeepEqual(cvol, proto.ChannelVolumes{32768, 32768}) {
+		t.Errorf("Unexpected volumes %v, %v", cvol, err)
+	}
+	cvol, err = absoluteVolumes(current, 1, 0.25)
+	if err != nil || !reflect.DeepEqual(cvol, proto.ChannelVolumes{65536, 16384}) {
+		t.Errorf("Unexpected per channel volumes %v, %v", cvol, err)
+	}
+	if _, err = absoluteVolumes(current, 1, 1, 1); err == nil {
+		t.Errorf("Expected error for mismatched channel count")
+	}
+	if _, err = absoluteVolumes(current, -1); err == nil {
+		t.Errorf("Expected error for negative volume")
+	}
+}
+
+func TestRelativeVolumes(t *testing.T) {
+	current := proto.ChannelVolumes{32768, 1000}
+
+	cvol, err := relativeVolumes(current, 0.25)
+	if err != nil || !reflect.DeepEqual(cvol, proto.ChannelVolumes{49152, 17384}) {
+		t.Errorf("Unexpected volumes %v, %v", cvol, err)
+	}
+	cvol, err = relativeVolumes(current, -0.25)
+	if err != nil || !reflect.DeepEqual(cvol, proto.ChannelVolumes{16384, 0}) {
+		t.Errorf("Unexpected decreased volumes %v, %v", cvol, err)
+	}
+}
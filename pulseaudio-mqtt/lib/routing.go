@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jfreymuth/pulse/proto"
+)
+
+// A RoutingRule moves new sink inputs whose properties all match the given
+// regular expressions to Sink, e.g.
+// {"properties": {"application.name": "Firefox"}, "sink": "alsa_output.usb-desk"}
+type RoutingRule struct {
+	Properties map[string]string `json:"properties"`
+	Sink       string            `json:"sink"`
+}
+
+type routingRule struct {
+	properties map[string]*regexp.Regexp
+	sink       string
+}
+
+// Compiles rules, with property patterns matching whole property values
+func compileRoutingRules(rules []RoutingRule) ([]routingRule, error) {
+	compiled := make([]routingRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Sink == "" || len(rule.Properties) == 0 {
+			return nil, fmt.Errorf("routing rule %d needs a sink and properties", i)
+		}
+		properties := make(map[string]*regexp.Regexp)
+		for key, pattern := range rule.Properties {
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("routing rule %d property %s: %w", i, key, err)
+			}
+			properties[key] = re
+		}
+		compiled = append(compiled, routingRule{properties: properties, sink: rule.Sink})
+	}
+	return compiled, nil
+}
+
+// Reads routing rules from a JSON file containing a list of rules
+func ReadRoutingRules(file string) ([]RoutingRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RoutingRule
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, err
+	}
+	_, err = compileRoutingRules(rules)
+	return rules, err
+}
+
+// Returns the sink of the first rule matching the sink input, or "" if none
+func routeSinkInput(rules []routingRule, sinkInput *SinkInput) string {
+	for _, rule := range rules {
+		matches := true
+		for key, re := range rule.properties {
+			if _, exists := sinkInput.info.Properties[key]; !exists || !re.MatchString(sinkInput.Property(key)) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return rule.sink
+		}
+	}
+	return ""
+}
+
+// Rules published retained on pulseaudio/routing/rules replace those from
+// config, an empty payload reverts to the config rules
+func (bridge *PulseaudioMQTTBridge) onRoutingRules(client mqtt.Client, message mqtt.Message) {
+	var rules []RoutingRule
+	if len(message.Payload()) == 0 {
+		rules = bridge.PulseClientConfig.RoutingRules
+	} else {
+		err := json.Unmarshal(message.Payload(), &rules)
+		if err != nil {
+			slog.Error("Could not parse routing rules", "error", err, "payload", string(message.Payload()))
+			return
+		}
+	}
+	compiled, err := compileRoutingRules(rules)
+	if err != nil {
+		slog.Error("Invalid routing rules", "error", err, "payload", string(message.Payload()))
+		return
+	}
+
+	bridge.routingMutex.Lock()
+	defer bridge.routingMutex.Unlock()
+	bridge.routingRules = compiled
+	slog.Info("Updated routing rules", "rules", len(compiled))
+}
+
+// Moves sink inputs not seen before to the sink of their matching rule.
+// Each sink input is only routed once, so later manual moves are kept.
+// With move false the sink inputs are only recorded as seen, which is
+// used at startup to leave inputs that were already playing alone.
+func (bridge *PulseaudioMQTTBridge) routeNewSinkInputs(move bool) {
+	bridge.routingMutex.Lock()
+	defer bridge.routingMutex.Unlock()
+
+	sinkInputs, err := bridge.PulseClient.ListSinkInputs()
+	if err != nil {
+		slog.Error("Could not retrieve sink inputs", "error", err)
+		return
+	}
+
+	for _, sinkInput := range bridge.newSinkInputs(sinkInputs) {
+		sink := routeSinkInput(bridge.routingRules, sinkInput)
+		if !move || sink == "" {
+			continue
+		}
+		index := sinkInput.SinkInputIndex()
+		slog.Info("Routing sink input", "sinkInputIndex", index,
+			"application", sinkInput.Property("application.name"), "sink", sink)
+		err = bridge.PulseClient.protoClient.Request(&proto.MoveSinkInput{
+			SinkInputIndex: index, DeviceIndex: proto.Undefined, DeviceName: sink}, nil)
+		if err != nil {
+			slog.Error("Could not route sink input", "error", err, "sinkInputIndex", index, "sink", sink)
+		}
+	}
+}
+
+// Returns the sink inputs not seen before and records them as seen,
+// forgetting those that are gone. Called with routingMutex held.
+func (bridge *PulseaudioMQTTBridge) newSinkInputs(sinkInputs []*SinkInput) []*SinkInput {
+	var added []*SinkInput
+	seen := make(map[uint32]bool)
+	for _, sinkInput := range sinkInputs {
+		index := sinkInput.SinkInputIndex()
+		seen[index] = true
+		if !bridge.routedSinkInputs[index] {
+			bridge.routedSinkInputs[index] = true
+			added = append(added, sinkInput)
+		}
+	}
+	for index := range bridge.routedSinkInputs {
+		if !seen[index] {
+			delete(bridge.routedSinkInputs, index)
+		}
+	}
+	return added
+}
@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/claes/mqtt-bridges/common/mqtttest"
+	"github.com/jfreymuth/pulse/proto"
+)
+
+func TestRouteSinkInput(t *testing.T) {
+	rules, err := compileRoutingRules([]RoutingRule{
+		{Properties: map[string]string{"application.name": "Firefox"}, Sink: "desk"},
+		{Properties: map[string]string{"application.name": "Music Player Daemon|mpd", "media.role": "music"}, Sink: "rotel"},
+		{Properties: map[string]string{"application.process.binary": ".*"}, Sink: "fallback"},
+	})
+	if err != nil {
+		t.Fatalf("Could not compile rules: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		props    proto.PropList
+		expected string
+	}{
+		{"First rule", proto.PropList{"application.name": proto.PropListString("Firefox")}, "desk"},
+		{"Whole value match", proto.PropList{"application.name": proto.PropListString("Firefox Nightly")}, ""},
+		{"All properties", proto.PropList{
+			"application.name": proto.PropListString("mpd"), "media.role": proto.PropListString("music")}, "rotel"},
+		{"Missing property", proto.PropList{"application.name": proto.PropListString("mpd")}, ""},
+		{"Any value", proto.PropList{"application.process.binary": proto.PropListString("")}, "fallback"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sinkInput := &SinkInput{info: proto.GetSinkInputInfoReply{Properties: tt.props}}
+			if sink := routeSinkInput(rules, sinkInput); sink != tt.expected {
+				t.Errorf("routeSinkInput = %q; want %q", sink, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCompileRoutingRulesErrors(t *testing.T) {
+	invalid := [][]RoutingRule{
+		{{Properties: map[string]string{"application.name": "Firefox"}}},
+		{{Sink: "desk"}},
+		{{Properties: map[string]string{"application.name": "("}, Sink: "desk"}},
+	}
+	for _, rules := range invalid {
+		if _, err := compileRoutingRules(rules); err == nil {
+			t.Errorf("Expected error for rules %v", rules)
+		}
+	}
+}
+
+func TestReadRoutingRules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.json")
+	err := os.WriteFile(file, []byte(`[{"properties": {"application.name": "Firefox"}, "sink": "desk"}]`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := ReadRoutingRules(file)
+	if err != nil || len(rules) != 1 || rules[0].Sink != "desk" || rules[0].Properties["application.name"] != "Firefox" {
+		t.Errorf("Unexpected rules %v, %v", rules, err)
+	}
+}
+
+func TestOnRoutingRules(t *testing.T) {
+	config := []RoutingRule{
+		{Properties: map[string]string{"application.name": "Firefox"}, Sink: "desk"},
+		{Properties: map[string]string{"application.name": "mpd"}, Sink: "rotel"},
+	}
+	bridge := &PulseaudioMQTTBridge{PulseClientConfig: PulseClientConfig{RoutingRules: config}}
+	sinkInput := &SinkInput{info: proto.GetSinkInputInfoReply{
+		Properties: proto.PropList{"application.name": proto.PropListString("Firefox")}}}
+
+	bridge.onRoutingRules(nil, mqtttest.NewMessage("pulseaudio/routing/rules",
+		`[{"properties": {"media.role": "music"}, "sink": "kitchen"}]`))
+	if sink := routeSinkInput(bridge.routingRules, sinkInput); sink != "" {
+		t.Errorf("Routed by replaced rules to %q", sink)
+	}
+	expected := []RoutingRule{
+		{Properties: map[string]string{"application.name": "Firefox"}, Sink: "desk"},
+		{Properties: map[string]string{"application.name": "mpd"}, Sink: "rotel"},
+	}
+	if !reflect.DeepEqual(bridge.PulseClientConfig.RoutingRules, expected) {
+		t.Errorf("Config rules changed to %v", bridge.PulseClientConfig.RoutingRules)
+	}
+
+	// Clearing the topic reverts to the config rules
+	bridge.onRoutingRules(nil, mqtttest.NewMessage("pulseaudio/routing/rules", ""))
+	if sink := routeSinkInput(bridge.routingRules, sinkInput); sink != "desk" {
+		t.Errorf("Routed to %q after clearing rules, expected desk", sink)
+	}
+}
+
+func TestNewSinkInputs(t *testing.T) {
+	bridge := &PulseaudioMQTTBridge{routedSinkInputs: make(map[uint32]bool)}
+	sinkInput := func(index uint32) *SinkInput {
+		return &SinkInput{info: proto.GetSinkInputInfoReply{SinkInputIndex: index}}
+	}
+	indexes := func(sinkInputs []*SinkInput) []uint32 {
+		var result []uint32
+		for _, sinkInput := range sinkInputs {
+			result = append(result, sinkInput.SinkInputIndex())
+		}
+		return result
+	}
+
+	if added := indexes(bridge.newSinkInputs([]*SinkInput{sinkInput(1), sinkInput(2)})); !reflect.DeepEqual(added, []uint32{1, 2}) {
+		t.Errorf("Unexpected new sink inputs %v", added)
+	}
+	if added := indexes(bridge.newSinkInputs([]*SinkInput{sinkInput(2), sinkInput(3)})); !reflect.DeepEqual(added, []uint32{3}) {
+		t.Errorf("Unexpected new sink inputs %v", added)
+	}
+	// Removed sink inputs are forgotten, as indexes may be reused
+	if added := indexes(bridge.newSinkInputs([]*SinkInput{sinkInput(1)})); !reflect.DeepEqual(added, []uint32{1}) {
+		t.Errorf("Unexpected new sink inputs %v", added)
+	}
+}
+
+func TestSubscriptionCallbackTriggersRouting(t *testing.T) {
+	eventChannels := map[proto.SubscriptionEventType]chan proto.SubscriptionEventType{
+		proto.EventNew: make(chan proto.SubscriptionEventType, 1),
+	}
+	routing := make(chan struct{}, 1)
+	callback := subscriptionCallback(eventChannels, routing)
+
+	// The client event fills the new event channel, the sink input
+	// created right after it must still be routed
+	callback(&proto.SubscribeEvent{Event: proto.EventNew | proto.EventClient, Index: 1})
+	callback(&proto.SubscribeEvent{Event: proto.EventNew | proto.EventSinkSinkInput, Index: 2})
+
+	select {
+	case <-routing:
+	default:
+		t.Fatal("Routing not triggered for new sink input")
+	}
+	if event := <-eventChannels[proto.EventNew]; event.GetFacility() != proto.EventClient {
+		t.Errorf("Expected client event, got %v", event)
+	}
+
+	callback(&proto.SubscribeEvent{Event: proto.EventChange | proto.EventSinkSinkInput, Index: 2})
+	select {
+	case <-routing:
+		t.Error("Routing triggered for changed sink input")
+	default:
+	}
+}
@@ -25,6 +25,7 @@ func main() {
 	pulseServer := flag.String("pulseserver", "", "Pulse server address")
 	topicPrefix := flag.String("topicPrefix", "", "MQTT topic prefix to use")
 	mqttBroker := flag.String("broker", "tcp://localhost:1883", "MQTT broker URL")
+	routingRules := flag.String("routing-rules", "", "JSON file with rules routing new sink inputs to sinks")
 	help := flag.Bool("help", false, "Print help")
 	debug = flag.Bool("debug", false, "Debug logging")
 	flag.Parse()
@@ -41,6 +42,13 @@ func main() {
 	}
 
 	pulseClientConfig := lib.PulseClientConfig{PulseServerAddress: *pulseServer}
+	if *routingRules != "" {
+		pulseClientConfig.RoutingRules, err = lib.ReadRoutingRules(*routingRules)
+		if err != nil {
+			slog.Error("Error reading routing rules", "error", err, "file", *routingRules)
+			os.Exit(1)
+		}
+	}
 	bridge, err := lib.NewPulseaudioMQTTBridge(pulseClientConfig, mqttClient, *topicPrefix)
 	if err != nil {
 		slog.Error("Error creating PulseaudioMQTTBridge", "error", err)
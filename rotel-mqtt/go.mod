@@ -3,10 +3,13 @@ module github.com/claes/mqtt-bridges/rotel-mqtt
 go 1.22.8
 
 require (
-	github.com/claes/mqtt-bridges/common v0.0.0-20241218194001-0e0f35dcc1d1 // indirect
-	github.com/eclipse/paho.mqtt.golang v1.5.0 // indirect
+	github.com/claes/mqtt-bridges/common v0.0.0-20241218194001-0e0f35dcc1d1
+	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
+)
+
+require (
 	github.com/gorilla/websocket v1.5.3 // indirect
-	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07 // indirect
 	golang.org/x/net v0.27.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	common "github.com/claes/mqtt-bridges/common"
+	"github.com/claes/mqtt-bridges/common/mqtttest"
+)
+
+// A fake serial port recording the commands written to it
+type fakeSerialPort struct {
+	mutex   sync.Mutex
+	writes  []string
+	closed  chan struct{}
+	closing sync.Once
+}
+
+func newFakeSerialPort() *fakeSerialPort {
+	return &fakeSerialPort{closed: make(chan struct{})}
+}
+
+// Blocks until the port is closed, the Rotel stays silent unless tests
+// feed ProcessRotelData
+func (p *fakeSerialPort) Read(buf []byte) (int, error) {
+	<-p.closed
+	return 0, io.EOF
+}
+
+func (p *fakeSerialPort) Write(buf []byte) (int, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.writes = append(p.writes, string(buf))
+	return len(buf), nil
+}
+
+func (p *fakeSerialPort) Close() error {
+	p.closing.Do(func() { close(p.closed) })
+	return nil
+}
+
+// Returns the commands written so far
+func (p *fakeSerialPort) written() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]string(nil), p.writes...)
+}
+
+// Creates a bridge on a fake serial port and MQTT client, without the
+// initialization queries NewRotelMQTTBridge sends
+func newTestBridge(commandTimeout time.Duration) (*RotelMQTTBridge, *fakeSerialPort, *mqtttest.Client) {
+	serialPort := newFakeSerialPort()
+	mqttClient := mqtttest.NewClient()
+	bridge := &RotelMQTTBridge{
+		BaseMQTTBridge: common.BaseMQTTBridge{
+			MQTTClient: mqttClient,
+		},
+		SerialPort:      serialPort,
+		RotelDataParser: *NewRotelDataParser(),
+		State:           &RotelState{},
+		commandTimeout:  commandTimeout,
+	}
+	return bridge, serialPort, mqttClient
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -2,7 +2,14 @@ package lib
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -27,15 +34,91 @@ type RotelState struct {
 	Volume   string `json:"volume"`
 }
 
+// Normalized representation of RotelState, with values parsed
+// into numbers and booleans. Fields are nil when the value is unknown
+// or not applicable, such as frequency for analog sources.
+type RotelNormalizedState struct {
+	Balance *int     `json:"balance"`
+	Bass    *int     `json:"bass"`
+	Freq    *float64 `json:"freq"`
+	Mute    bool     `json:"mute"`
+	Power   bool     `json:"power"`
+	Source  string   `json:"source"`
+	Tone    bool     `json:"tone"`
+	Treble  *int     `json:"treble"`
+	Volume  *int     `json:"volume"`
+}
+
+func (state *RotelState) Normalize() RotelNormalizedState {
+	return RotelNormalizedState{
+		Balance: parseRotelBalance(state.Balance),
+		Bass:    parseRotelTone(state.Bass),
+		Freq:    parseRotelFreq(state.Freq),
+		Mute:    state.Mute == "on",
+		Power:   state.State == "on",
+		Source:  state.Source,
+		Tone:    state.Tone == "on",
+		Treble:  parseRotelTone(state.Treble),
+		Volume:  parseRotelVolume(state.Volume),
+	}
+}
+
 type RotelMQTTBridge struct {
 	common.BaseMQTTBridge
-	SerialPort       *serial.Port
+	SerialPort       io.ReadWriteCloser
 	RotelDataParser  RotelDataParser
 	State            *RotelState
 	sendMutex        sync.Mutex
 	serialWriteMutex sync.Mutex
+
+	timerMutex  sync.Mutex
+	volume      *int
+	volumeRamp  *volumeRamp
+	sleepCancel context.CancelFunc
+
+	pendingMutex    sync.Mutex
+	pendingCommands []*pendingCommand
+	commandTimeout  time.Duration
+}
+
+// Published on rotel/command/result for each tracked command
+type RotelCommandResult struct {
+	Command  string `json:"command"`
+	Success  bool   `json:"success"`
+	Response string `json:"response,omitempty"`
+	Attempts int    `json:"attempts"`
+}
+
+// A command sent to the Rotel awaiting a response with the given key,
+// and value unless empty
+type pendingCommand struct {
+	command  string
+	key      string
+	value    string
+	attempts int
+	timer    *time.Timer
+}
+
+// Payload of rotel/volume/ramp, duration in seconds
+type RotelVolumeRamp struct {
+	Volume   int `json:"volume"`
+	Duration int `json:"duration"`
 }
 
+// An ongoing volume ramp. Any reported volume other than the last one the
+// ramp set means the volume was changed by someone else.
+type volumeRamp struct {
+	cancel context.CancelFunc
+	volume int
+}
+
+const (
+	maxVolume             = 96
+	minVolumeRampInterval = 250 * time.Millisecond
+	commandTimeout        = 2 * time.Second
+	commandAttempts       = 3
+)
+
 type RotelClientConfig struct {
 	SerialDevice string
 }
@@ -68,11 +151,14 @@ func NewRotelMQTTBridge(config RotelClientConfig, mqttClient mqtt.Client, topicP
 		SerialPort:      serialPort,
 		RotelDataParser: *NewRotelDataParser(),
 		State:           &RotelState{},
+		commandTimeout:  commandTimeout,
 	}
 
 	funcs := map[string]func(client mqtt.Client, message mqtt.Message){
 		"rotel/command/send":       bridge.onCommandSend,
 		"rotel/command/initialize": bridge.onInitialize,
+		"rotel/volume/ramp":        bridge.onVolumeRamp,
+		"rotel/sleep/set":          bridge.onSleepSet,
 	}
 	for key, function := range funcs {
 		token := mqttClient.Subscribe(common.Prefixify(topicPrefix, key), 0, function)
@@ -111,7 +197,10 @@ func (bridge *RotelMQTTBridge) onCommandSend(client mqtt.Client, message mqtt.Me
 	command := string(message.Payload())
 	if command != "" {
 		bridge.PublishStringMQTT("rotel/command/send", "", false)
-		bridge.SendSerialRequest(command)
+		if strings.HasPrefix(command, "volume") {
+			bridge.cancelVolumeRamp()
+		}
+		bridge.SendTrackedSerialRequest(command)
 	}
 }
 
@@ -123,6 +212,189 @@ func (bridge *RotelMQTTBridge) onInitialize(client mqtt.Client, message mqtt.Mes
 	}
 }
 
+func (bridge *RotelMQTTBridge) onVolumeRamp(client mqtt.Client, message mqtt.Message) {
+	if len(message.Payload()) == 0 {
+		return
+	}
+	var ramp RotelVolumeRamp
+	err := json.Unmarshal(message.Payload(), &ramp)
+	if err != nil {
+		slog.Error("Could not parse volume ramp", "payload", string(message.Payload()), "error", err)
+		return
+	}
+	bridge.PublishStringMQTT("rotel/volume/ramp", "", false)
+	bridge.startVolumeRamp(max(0, min(ramp.Volume, maxVolume)), time.Duration(ramp.Duration)*time.Second)
+}
+
+func (bridge *RotelMQTTBridge) onSleepSet(client mqtt.Client, message mqtt.Message) {
+	p := string(message.Payload())
+	if p == "" {
+		return
+	}
+	minutes, err := strconv.Atoi(p)
+	if err != nil {
+		slog.Error("Could not parse sleep minutes", "payload", p, "error", err)
+		return
+	}
+	bridge.PublishStringMQTT("rotel/sleep/set", "", false)
+	bridge.startSleepTimer(time.Duration(minutes) * time.Minute)
+}
+
+func (bridge *RotelMQTTBridge) startVolumeRamp(target int, duration time.Duration) {
+	bridge.timerMutex.Lock()
+	defer bridge.timerMutex.Unlock()
+
+	if bridge.volumeRamp != nil {
+		bridge.volumeRamp.cancel()
+		bridge.volumeRamp = nil
+	}
+	from := target
+	if bridge.volume != nil {
+		from = *bridge.volume
+	}
+	if from == target {
+		// Unknown or already reached, set directly
+		bridge.SendSerialRequest(fmt.Sprintf("volume_%02d!", target))
+		return
+	}
+
+	steps := target - from
+	if steps < 0 {
+		steps = -steps
+	}
+	steps = max(1, min(steps, int(duration/minVolumeRampInterval)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ramp := &volumeRamp{cancel: cancel, volume: from}
+	bridge.volumeRamp = ramp
+	slog.Info("Starting volume ramp", "from", from, "to", target, "duration", duration)
+	go bridge.runVolumeRamp(ctx, ramp, from, target, steps, duration/time.Duration(steps))
+}
+
+func (bridge *RotelMQTTBridge) runVolumeRamp(ctx context.Context, ramp *volumeRamp, from, target, steps int, interval time.Duration) {
+	ticker := time.NewTicker(max(interval, time.Millisecond))
+	defer ticker.Stop()
+
+	for i := 1; i <= steps; i++ {
+		select {
+		case <-ctx.Done():
+			slog.Info("Volume ramp cancelled")
+			return
+		case <-ticker.C:
+		}
+		volume := from + (target-from)*i/steps
+
+		bridge.timerMutex.Lock()
+		if bridge.volumeRamp != ramp {
+			bridge.timerMutex.Unlock()
+			return
+		}
+		ramp.volume = volume
+		bridge.timerMutex.Unlock()
+
+		bridge.SendSerialRequest(fmt.Sprintf("volume_%02d!", volume))
+	}
+
+	bridge.timerMutex.Lock()
+	if bridge.volumeRamp == ramp {
+		bridge.volumeRamp = nil
+	}
+	bridge.timerMutex.Unlock()
+	slog.Info("Volume ramp finished", "volume", target)
+}
+
+func (bridge *RotelMQTTBridge) cancelVolumeRamp() {
+	bridge.timerMutex.Lock()
+	defer bridge.timerMutex.Unlock()
+
+	if bridge.volumeRamp != nil {
+		bridge.volumeRamp.cancel()
+		bridge.volumeRamp = nil
+	}
+}
+
+// Tracks the volume reported by the amplifier and cancels any ongoing
+// ramp if the volume was changed by someone else
+func (bridge *RotelMQTTBridge) observeVolume(value string) {
+	bridge.timerMutex.Lock()
+	defer bridge.timerMutex.Unlock()
+
+	bridge.volume = parseRotelVolume(value)
+	ramp := bridge.volumeRamp
+	if ramp != nil && (bridge.volume == nil || *bridge.volume != ramp.volume) {
+		slog.Info("Volume changed during ramp, cancelling", "volume", value)
+		ramp.cancel()
+		bridge.volumeRamp = nil
+	}
+}
+
+func (bridge *RotelMQTTBridge) startSleepTimer(duration time.Duration) {
+	bridge.timerMutex.Lock()
+	defer bridge.timerMutex.Unlock()
+
+	if bridge.sleepCancel != nil {
+		bridge.sleepCancel()
+		bridge.sleepCancel = nil
+	}
+	if duration <= 0 {
+		bridge.PublishStringMQTT("rotel/sleep", "0", true)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bridge.sleepCancel = cancel
+	slog.Info("Starting sleep timer", "duration", duration)
+	go bridge.runSleepTimer(ctx, time.Now().Add(duration))
+}
+
+func (bridge *RotelMQTTBridge) runSleepTimer(ctx context.Context, deadline time.Time) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		remaining := int(math.Ceil(time.Until(deadline).Minutes()))
+		if remaining <= 0 {
+			break
+		}
+		// Published under lock so a cancelled timer cannot overwrite the
+		// cleared value
+		bridge.timerMutex.Lock()
+		if ctx.Err() == nil {
+			bridge.PublishStringMQTT("rotel/sleep", strconv.Itoa(remaining), true)
+		}
+		bridge.timerMutex.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-time.After(time.Until(deadline)):
+		}
+	}
+
+	bridge.timerMutex.Lock()
+	if ctx.Err() != nil {
+		bridge.timerMutex.Unlock()
+		return
+	}
+	bridge.sleepCancel = nil
+	bridge.timerMutex.Unlock()
+
+	slog.Info("Sleep timer expired, powering off")
+	bridge.PublishStringMQTT("rotel/sleep", "0", true)
+	bridge.SendTrackedSerialRequest("power_off!")
+}
+
+func (bridge *RotelMQTTBridge) cancelSleepTimer() {
+	bridge.timerMutex.Lock()
+	defer bridge.timerMutex.Unlock()
+
+	if bridge.sleepCancel != nil {
+		bridge.sleepCancel()
+		bridge.sleepCancel = nil
+		bridge.PublishStringMQTT("rotel/sleep", "0", true)
+	}
+}
+
 func (bridge *RotelMQTTBridge) EventLoop(ctx context.Context) {
 	defer bridge.SerialPort.Close()
 
@@ -143,6 +415,7 @@ func (bridge *RotelMQTTBridge) EventLoop(ctx context.Context) {
 			bridge.ProcessRotelData(string(buf[:n]))
 
 			bridge.PublishJSONMQTT("rotel/state", bridge.State, true)
+			bridge.PublishJSONMQTT("rotel/state/normalized", bridge.State.Normalize(), true)
 		}
 	}
 }
@@ -157,16 +430,83 @@ func (bridge *RotelMQTTBridge) SendSerialRequest(message string) {
 	}
 }
 
+// Sends a command and waits for the expected response, retrying absolute
+// commands on timeout. The outcome is published on rotel/command/result.
+// Commands without a known response are sent without tracking.
+func (bridge *RotelMQTTBridge) SendTrackedSerialRequest(command string) {
+	key, value := expectedResponse(command)
+	if key == "" {
+		bridge.SendSerialRequest(command)
+		return
+	}
+
+	pending := &pendingCommand{command: command, key: key, value: value, attempts: 1}
+	bridge.pendingMutex.Lock()
+	bridge.pendingCommands = append(bridge.pendingCommands, pending)
+	pending.timer = time.AfterFunc(bridge.commandTimeout, func() { bridge.onCommandTimeout(pending) })
+	bridge.pendingMutex.Unlock()
+
+	bridge.SendSerialRequest(command)
+}
+
+func (bridge *RotelMQTTBridge) onCommandTimeout(pending *pendingCommand) {
+	bridge.pendingMutex.Lock()
+	i := slices.Index(bridge.pendingCommands, pending)
+	if i == -1 {
+		bridge.pendingMutex.Unlock()
+		return
+	}
+	// Only absolute commands are resent, resending a toggle or a step
+	// such as power_toggle! or volume_up! could apply it twice
+	if pending.attempts >= commandAttempts || pending.value == "" {
+		bridge.pendingCommands = slices.Delete(bridge.pendingCommands, i, i+1)
+		bridge.pendingMutex.Unlock()
+
+		slog.Error("No response to command", "command", pending.command, "attempts", pending.attempts)
+		bridge.PublishJSONMQTT("rotel/command/result",
+			RotelCommandResult{Command: pending.command, Success: false, Attempts: pending.attempts}, false)
+		return
+	}
+	pending.attempts++
+	attempts := pending.attempts
+	pending.timer.Reset(bridge.commandTimeout)
+	bridge.pendingMutex.Unlock()
+
+	slog.Debug("Retrying command", "command", pending.command, "attempt", attempts)
+	bridge.SendSerialRequest(pending.command)
+}
+
+// Acknowledges the oldest pending command expecting the given response
+func (bridge *RotelMQTTBridge) acknowledgeCommand(key, value string) {
+	bridge.pendingMutex.Lock()
+	i := slices.IndexFunc(bridge.pendingCommands, func(p *pendingCommand) bool {
+		return p.key == key && responseValueMatches(key, p.value, value)
+	})
+	if i == -1 {
+		bridge.pendingMutex.Unlock()
+		return
+	}
+	pending := bridge.pendingCommands[i]
+	pending.timer.Stop()
+	bridge.pendingCommands = slices.Delete(bridge.pendingCommands, i, i+1)
+	bridge.pendingMutex.Unlock()
+
+	bridge.PublishJSONMQTT("rotel/command/result",
+		RotelCommandResult{Command: pending.command, Success: true, Response: key + "=" + value, Attempts: pending.attempts}, false)
+}
+
 func (bridge *RotelMQTTBridge) ProcessRotelData(data string) {
 
 	bridge.RotelDataParser.HandleParsedData(data)
 
 	for cmd := bridge.RotelDataParser.GetNextRotelData(); cmd != nil; cmd = bridge.RotelDataParser.GetNextRotelData() {
 		slog.Debug("Processed Rotel data", "data", data, "command", cmd)
+		bridge.acknowledgeCommand(cmd[0], cmd[1])
 
 		switch action := cmd[0]; action {
 		case "volume":
 			bridge.State.Volume = cmd[1]
+			bridge.observeVolume(cmd[1])
 		case "source":
 			bridge.State.Source = cmd[1]
 		case "freq":
@@ -197,9 +537,13 @@ func (bridge *RotelMQTTBridge) ProcessRotelData(data string) {
 				bridge.initialize(false)
 			} else if cmd[1] == "standby" {
 				bridge.State.State = cmd[1]
+				bridge.cancelVolumeRamp()
+				bridge.cancelSleepTimer()
 				bridge.initialize(false)
 			}
 		case "power_off":
+			bridge.cancelVolumeRamp()
+			bridge.cancelSleepTimer()
 			bridge.State.State = "standby"
 			bridge.State.Volume = ""
 			bridge.State.Source = ""
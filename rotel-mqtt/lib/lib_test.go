@@ -1,7 +1,13 @@
 package lib
 
 import (
+	"encoding/json"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/claes/mqtt-bridges/common/mqtttest"
 )
 
 func TestTerminated(t *testing.T) {
@@ -66,7 +72,8 @@ func TestMixed(t *testing.T) {
 
 func TestFoo(t *testing.T) {
 	r := NewRotelDataParser()
-	//r.HandleParsedData(" PCM    volume=39!source=opt1!fr")
+	r.HandleParsedData(" PCM    volume=39!source=opt1!fr")
+	r.HandleParsedData("eq=44.1!")
 
 	r.HandleParsedData("power=on!")
 	found := false
@@ -74,6 +81,9 @@ func TestFoo(t *testing.T) {
 		switch action := cmd[0]; action {
 		case "power":
 			found = true
+		case "volume", "source", "freq":
+		default:
+			t.Error("Unexpected data ", cmd)
 		}
 	}
 	if !found {
@@ -82,16 +92,50 @@ func TestFoo(t *testing.T) {
 }
 
 func TestDisplay(t *testing.T) {
-	r := matchDisplay("display1=XX", "display1=04,abcde")
-	if *r != "abcd" {
-		t.Error("Failed match, expected abcd, was " + *r)
+	r := NewRotelDataParser()
+	r.HandleParsedData("display1=04,abcde")
+	rotelData := r.GetNextRotelData()
+	if rotelData[0] != "display1" || rotelData[1] != "abcd" {
+		t.Error("Failed match, expected abcd, was ", rotelData)
+	}
+
+	r = NewRotelDataParser()
+	r.HandleParsedData("display2=004,abcde")
+	rotelData = r.GetNextRotelData()
+	if rotelData[0] != "display2" || rotelData[1] != "abcd" {
+		t.Error("Failed match, expected abcd, was ", rotelData)
+	}
+}
+
+func TestNoise(t *testing.T) {
+	r := NewRotelDataParser()
+	r.HandleParsedData("volume=39source=opt1!")
+	r.HandleParsedData("###!!==,,freq=44.1!")
+
+	rotelData := r.GetNextRotelData()
+	if rotelData[0] != "source" || rotelData[1] != "opt1" {
+		t.Error("Expected 'source, opt1', got ", rotelData)
+	}
+
+	rotelData = r.GetNextRotelData()
+	if rotelData[0] != "freq" || rotelData[1] != "44.1" {
+		t.Error("Expected 'freq, 44.1', got ", rotelData)
 	}
+}
 
-	r = matchDisplay("display1=XXX", "display1=004,abcde")
-	if *r != "abcd" {
-		t.Error("Failed match, expected abcd, was " + *r)
+func TestBounded(t *testing.T) {
+	r := NewRotelDataParser()
+	r.HandleParsedData("volume=" + strings.Repeat("9", 10000))
+	r.HandleParsedData(strings.Repeat("x", 10000))
+	if len(r.key) > maxKeyLength || len(r.value) > maxValueLength {
+		t.Error("Parser buffers not bounded ", len(r.key), len(r.value))
 	}
 
+	r.HandleParsedData("!source=coax1!")
+	rotelData := r.GetNextRotelData()
+	if rotelData[0] != "source" || rotelData[1] != "coax1" {
+		t.Error("Expected 'source, coax1', got ", rotelData)
+	}
 }
 
 func TestTerminatedNew(t *testing.T) {
@@ -121,3 +165,298 @@ func TestTerminatedNew(t *testing.T) {
 	}
 
 }
+
+func TestNormalize(t *testing.T) {
+	state := RotelState{
+		Balance: "L05",
+		Bass:    "-02",
+		Freq:    "44.1",
+		Mute:    "on",
+		Source:  "coax1",
+		State:   "on",
+		Tone:    "on",
+		Treble:  "+03",
+		Volume:  "039",
+	}
+	n := state.Normalize()
+	if n.Volume == nil || *n.Volume != 39 {
+		t.Error("Expected volume 39, got ", n.Volume)
+	}
+	if n.Bass == nil || *n.Bass != -2 {
+		t.Error("Expected bass -2, got ", n.Bass)
+	}
+	if n.Treble == nil || *n.Treble != 3 {
+		t.Error("Expected treble 3, got ", n.Treble)
+	}
+	if n.Balance == nil || *n.Balance != -5 {
+		t.Error("Expected balance -5, got ", n.Balance)
+	}
+	if n.Freq == nil || *n.Freq != 44.1 {
+		t.Error("Expected freq 44.1, got ", n.Freq)
+	}
+	if !n.Mute || !n.Power || !n.Tone {
+		t.Error("Expected mute, power and tone on, got ", n)
+	}
+
+	state = RotelState{Balance: "R03", Freq: "off", State: "standby", Mute: "off"}
+	n = state.Normalize()
+	if n.Balance == nil || *n.Balance != 3 {
+		t.Error("Expected balance 3, got ", n.Balance)
+	}
+	if n.Freq != nil {
+		t.Error("Expected no freq, got ", *n.Freq)
+	}
+	if n.Volume != nil {
+		t.Error("Expected no volume, got ", *n.Volume)
+	}
+	if n.Mute || n.Power {
+		t.Error("Expected mute and power off, got ", n)
+	}
+}
+
+func TestExpectedResponse(t *testing.T) {
+	tests := map[string][2]string{
+		"power_on!":            {"power", "on"},
+		"power_off!":           {"power", "standby"},
+		"power_toggle!":        {"power", ""},
+		"get_current_power!":   {"power", ""},
+		"volume_up!":           {"volume", ""},
+		"volume_39!":           {"volume", "39"},
+		"mute_on!":             {"mute", "on"},
+		"mute_off!":            {"mute", "off"},
+		"mute!":                {"mute", ""},
+		"coax1!":               {"source", "coax1"},
+		"get_current_source":   {"", ""},
+		"get_current_freq!":    {"freq", ""},
+		"get_display1!":        {"display1", ""},
+		"display_update_auto!": {"display_update", ""},
+		"bass_down!":           {"bass", ""},
+		"power_on!volume_up!":  {"", ""},
+		"unknown!":             {"", ""},
+	}
+	for command, expected := range tests {
+		if key, value := expectedResponse(command); key != expected[0] || value != expected[1] {
+			t.Errorf("expectedResponse(%q) = %q, %q, expected %q", command, key, value, expected)
+		}
+	}
+}
+
+func TestResponseValueMatches(t *testing.T) {
+	tests := []struct {
+		key, expected, value string
+		matches              bool
+	}{
+		{"power", "on", "on", true},
+		{"power", "on", "standby", false},
+		{"power", "", "standby", true},
+		{"source", "coax1", "opt1", false},
+		{"volume", "05", "5", true},
+		{"volume", "00", "min", true},
+		{"volume", "39", "40", false},
+	}
+	for _, test := range tests {
+		if matches := responseValueMatches(test.key, test.expected, test.value); matches != test.matches {
+			t.Errorf("responseValueMatches(%q, %q, %q) = %v", test.key, test.expected, test.value, matches)
+		}
+	}
+}
+
+func commandResults(t *testing.T, mqttClient *mqtttest.Client) []RotelCommandResult {
+	t.Helper()
+	var results []RotelCommandResult
+	for _, payload := range mqttClient.Payloads("rotel/command/result") {
+		var result RotelCommandResult
+		if err := json.Unmarshal([]byte(payload), &result); err != nil {
+			t.Fatalf("Could not unmarshal result %q: %v", payload, err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func TestCommandAcknowledged(t *testing.T) {
+	bridge, _, mqttClient := newTestBridge(time.Second)
+
+	bridge.SendTrackedSerialRequest("power_on!")
+	// A response with another value does not acknowledge the command
+	bridge.ProcessRotelData("power=standby!")
+	if results := commandResults(t, mqttClient); len(results) != 0 {
+		t.Fatalf("Acknowledged by other value %+v", results)
+	}
+	bridge.ProcessRotelData("power=on!")
+	results := commandResults(t, mqttClient)
+	expected := RotelCommandResult{Command: "power_on!", Success: true, Response: "power=on", Attempts: 1}
+	if len(results) != 1 || results[0] != expected {
+		t.Errorf("Unexpected results %+v, expected %+v", results, expected)
+	}
+
+	bridge.SendTrackedSerialRequest("volume_05!")
+	bridge.ProcessRotelData("volume=5!")
+	results = commandResults(t, mqttClient)
+	if len(results) != 2 || !results[1].Success || results[1].Command != "volume_05!" {
+		t.Errorf("Volume not acknowledged %+v", results)
+	}
+}
+
+func TestCommandRetried(t *testing.T) {
+	bridge, serialPort, mqttClient := newTestBridge(20 * time.Millisecond)
+
+	bridge.SendTrackedSerialRequest("coax1!")
+	waitFor(t, "retry", func() bool { return len(serialPort.written()) == 2 })
+	bridge.ProcessRotelData("source=coax1!")
+
+	results := commandResults(t, mqttClient)
+	expected := RotelCommandResult{Command: "coax1!", Success: true, Response: "source=coax1", Attempts: 2}
+	if len(results) != 1 || results[0] != expected {
+		t.Errorf("Unexpected results %+v, expected %+v", results, expected)
+	}
+	if written := serialPort.written(); len(written) != 2 || written[0] != "coax1!" || written[1] != "coax1!" {
+		t.Errorf("Unexpected commands written %q", written)
+	}
+}
+
+func TestToggleNotRetried(t *testing.T) {
+	bridge, serialPort, mqttClient := newTestBridge(20 * time.Millisecond)
+
+	for _, command := range []string{"power_toggle!", "mute!", "volume_up!", "bass_up!"} {
+		bridge.SendTrackedSerialRequest(command)
+	}
+	waitFor(t, "results", func() bool { return len(mqttClient.Payloads("rotel/command/result")) == 4 })
+
+	for _, result := range commandResults(t, mqttClient) {
+		if result.Success || result.Attempts != 1 {
+			t.Errorf("Unexpected result %+v", result)
+		}
+	}
+	// Give any retry a chance to show up
+	time.Sleep(50 * time.Millisecond)
+	expected := []string{"power_toggle!", "mute!", "volume_up!", "bass_up!"}
+	if written := serialPort.written(); !slices.Equal(written, expected) {
+		t.Errorf("Unexpected commands written %q, expected %q", written, expected)
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	bridge, serialPort, mqttClient := newTestBridge(20 * time.Millisecond)
+
+	bridge.SendTrackedSerialRequest("mute_on!")
+	bridge.ProcessRotelData("mute=off!")
+	waitFor(t, "result", func() bool { return len(mqttClient.Payloads("rotel/command/result")) > 0 })
+
+	results := commandResults(t, mqttClient)
+	expected := RotelCommandResult{Command: "mute_on!", Success: false, Attempts: commandAttempts}
+	if len(results) != 1 || results[0] != expected {
+		t.Errorf("Unexpected results %+v, expected %+v", results, expected)
+	}
+	if written := serialPort.written(); len(written) != commandAttempts {
+		t.Errorf("Expected %d attempts, got %q", commandAttempts, written)
+	}
+
+	// A late response is not taken for the failed command
+	bridge.ProcessRotelData("mute=on!")
+	if results := commandResults(t, mqttClient); len(results) != 1 {
+		t.Errorf("Unexpected results after timeout %+v", results)
+	}
+}
+
+// Returns the volume commands written so far
+func volumeCommands(serialPort *fakeSerialPort) []string {
+	var commands []string
+	for _, command := range serialPort.written() {
+		if strings.HasPrefix(command, "volume_") {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+func TestVolumeRamp(t *testing.T) {
+	bridge, serialPort, _ := newTestBridge(time.Second)
+	bridge.observeVolume("20")
+
+	bridge.startVolumeRamp(17, 3*minVolumeRampInterval)
+	waitFor(t, "ramp", func() bool { return len(volumeCommands(serialPort)) == 3 })
+	expected := []string{"volume_19!", "volume_18!", "volume_17!"}
+	if commands := volumeCommands(serialPort); !slices.Equal(commands, expected) {
+		t.Errorf("Unexpected ramp %q, expected %q", commands, expected)
+	}
+	waitFor(t, "ramp finished", func() bool {
+		bridge.timerMutex.Lock()
+		defer bridge.timerMutex.Unlock()
+		return bridge.volumeRamp == nil
+	})
+}
+
+func TestVolumeRampCancelledByCommand(t *testing.T) {
+	bridge, serialPort, _ := newTestBridge(time.Second)
+	bridge.observeVolume("20")
+
+	bridge.startVolumeRamp(40, 20*minVolumeRampInterval)
+	waitFor(t, "ramp step", func() bool { return len(volumeCommands(serialPort)) == 1 })
+	bridge.onCommandSend(nil, mqtttest.NewMessage("rotel/command/send", "volume_30!"))
+
+	time.Sleep(2 * minVolumeRampInterval)
+	expected := []string{"volume_21!", "volume_30!"}
+	if commands := volumeCommands(serialPort); !slices.Equal(commands, expected) {
+		t.Errorf("Unexpected volume commands %q, expected %q", commands, expected)
+	}
+}
+
+func TestVolumeRampCancelledByObservedVolume(t *testing.T) {
+	bridge, serialPort, _ := newTestBridge(time.Second)
+	bridge.observeVolume("20")
+
+	bridge.startVolumeRamp(40, 20*minVolumeRampInterval)
+	waitFor(t, "ramp step", func() bool { return len(volumeCommands(serialPort)) == 1 })
+
+	// The volume the ramp set last is its own
+	bridge.ProcessRotelData("volume=21!")
+	waitFor(t, "next ramp step", func() bool { return len(volumeCommands(serialPort)) == 2 })
+
+	// Anything else was changed on the amplifier itself, even when
+	// within the range the ramp has covered
+	bridge.ProcessRotelData("volume=21!")
+	bridge.timerMutex.Lock()
+	ramp := bridge.volumeRamp
+	bridge.timerMutex.Unlock()
+	if ramp != nil {
+		t.Fatal("Ramp not cancelled by volume changed during ramp")
+	}
+	time.Sleep(2 * minVolumeRampInterval)
+	if commands := volumeCommands(serialPort); len(commands) != 2 {
+		t.Errorf("Ramp continued after cancel %q", commands)
+	}
+}
+
+func TestSleepTimer(t *testing.T) {
+	bridge, serialPort, mqttClient := newTestBridge(time.Second)
+
+	bridge.startSleepTimer(50 * time.Millisecond)
+	waitFor(t, "power off", func() bool { return slices.Contains(serialPort.written(), "power_off!") })
+
+	if payloads := mqttClient.Payloads("rotel/sleep"); !slices.Equal(payloads, []string{"1", "0"}) {
+		t.Errorf("Unexpected sleep payloads %q", payloads)
+	}
+	if payload, _ := mqttClient.Retained("rotel/sleep"); payload != "0" {
+		t.Errorf("Sleep not cleared, retained %q", payload)
+	}
+	bridge.ProcessRotelData("power=standby!")
+	if results := commandResults(t, mqttClient); len(results) != 1 || !results[0].Success {
+		t.Errorf("Power off not acknowledged %+v", results)
+	}
+}
+
+func TestSleepTimerCancelled(t *testing.T) {
+	bridge, serialPort, mqttClient := newTestBridge(time.Second)
+
+	bridge.startSleepTimer(50 * time.Millisecond)
+	bridge.startSleepTimer(0)
+	time.Sleep(100 * time.Millisecond)
+
+	if written := serialPort.written(); len(written) != 0 {
+		t.Errorf("Unexpected commands after cancel %q", written)
+	}
+	if payload, _ := mqttClient.Retained("rotel/sleep"); payload != "0" {
+		t.Errorf("Sleep not cleared, retained %q", payload)
+	}
+}
@@ -3,20 +3,43 @@ package lib
 import (
 	"strconv"
 	"strings"
-	// "encoding/json"
 )
 
 // Rotel data parser
+//
+// The Rotel sends a stream of either terminated "key=value!" pairs or
+// fixed length "display=NNN,<NNN characters>" pairs. The parser is a
+// state machine fed one byte at a time. Bytes that cannot be part of a
+// pair are dropped, so the parser resynchronises on the next key, and
+// each partial key, value and display text is capped in length.
+
+const (
+	maxKeyLength         = 32
+	maxValueLength       = 64
+	maxDisplayLengthSize = 3
+)
+
+type rotelParserState int
+
+const (
+	parseKey rotelParserState = iota
+	parseValue
+	parseDisplayLength
+	parseDisplayText
+)
 
 type RotelDataParser struct {
 	RotelDataQueue [][]string
-	buffer         string
+	state          rotelParserState
+	key            []byte
+	value          []byte
+	displayLength  int
 }
 
 func NewRotelDataParser() *RotelDataParser {
 	return &RotelDataParser{
 		RotelDataQueue: [][]string{},
-		buffer:         "",
+		state:          parseKey,
 	}
 }
 
@@ -35,86 +58,234 @@ func (rdp *RotelDataParser) PushKeyValuePair(keyValuePair string) {
 	rdp.RotelDataQueue = append(rdp.RotelDataQueue, keyValue)
 }
 
-func matchCommand(input string) bool {
-	return strings.Count(input, "=") == 1 &&
-		strings.HasSuffix(input, "!")
+func isKeyByte(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_'
 }
 
-func matchDisplay(pattern, input string) *string {
+func isDisplayKey(key string) bool {
+	return key == "display" || key == "display1" || key == "display2"
+}
 
-	pos := strings.Index(pattern, "=")
-	if pos == -1 {
-		return nil
-	}
+func (rdp *RotelDataParser) reset() {
+	rdp.state = parseKey
+	rdp.key = rdp.key[:0]
+	rdp.value = rdp.value[:0]
+	rdp.displayLength = 0
+}
 
-	prefix := pattern[:pos+1]
-	lengthFormat := pattern[pos+1:]
+func (rdp *RotelDataParser) emit() {
+	rdp.RotelDataQueue = append(rdp.RotelDataQueue, []string{string(rdp.key), string(rdp.value)})
+	rdp.reset()
+}
 
-	startIndex := strings.Index(input, prefix)
-	if startIndex == -1 {
-		return nil
+// Restart key parsing from the trailing key characters of the current
+// value, i.e. "39source" when a "!" was lost in "volume=39source=".
+// A tail too long to be a key is dropped.
+func (rdp *RotelDataParser) resyncFromValue() {
+	i := len(rdp.value)
+	for i > 0 && isKeyByte(rdp.value[i-1]) {
+		i--
+	}
+	for i < len(rdp.value) && rdp.value[i] >= '0' && rdp.value[i] <= '9' {
+		i++
+	}
+	key := append([]byte{}, rdp.value[i:]...)
+	rdp.reset()
+	if len(key) <= maxKeyLength {
+		rdp.key = append(rdp.key, key...)
 	}
+}
 
-	numberStartIndex := startIndex + len(prefix)
+func (rdp *RotelDataParser) handleByte(c byte) {
+	switch rdp.state {
+	case parseKey:
+		switch {
+		case c == '=' && len(rdp.key) > 0:
+			if isDisplayKey(string(rdp.key)) {
+				rdp.state = parseDisplayLength
+			} else {
+				rdp.state = parseValue
+			}
+		case isKeyByte(c) && len(rdp.key) < maxKeyLength:
+			rdp.key = append(rdp.key, c)
+		default:
+			rdp.reset()
+		}
+	case parseValue:
+		switch {
+		case c == '!':
+			rdp.emit()
+		case c == '=':
+			rdp.resyncFromValue()
+			if len(rdp.key) > 0 {
+				rdp.handleByte(c)
+			}
+		case len(rdp.value) < maxValueLength:
+			rdp.value = append(rdp.value, c)
+		default:
+			rdp.reset()
+		}
+	case parseDisplayLength:
+		switch {
+		case c == ',' && len(rdp.value) > 0:
+			rdp.displayLength, _ = strconv.Atoi(string(rdp.value))
+			rdp.value = rdp.value[:0]
+			if rdp.displayLength == 0 {
+				rdp.emit()
+			} else {
+				rdp.state = parseDisplayText
+			}
+		case c >= '0' && c <= '9' && len(rdp.value) < maxDisplayLengthSize:
+			rdp.value = append(rdp.value, c)
+		default:
+			rdp.reset()
+		}
+	case parseDisplayText:
+		rdp.value = append(rdp.value, c)
+		if len(rdp.value) == rdp.displayLength {
+			rdp.emit()
+		}
+	}
+}
 
-	if numberStartIndex+len(lengthFormat) > len(input) {
-		return nil
+func (rdp *RotelDataParser) HandleParsedData(data string) {
+	for i := 0; i < len(data); i++ {
+		rdp.handleByte(data[i])
 	}
+}
 
-	numberStr := input[numberStartIndex : numberStartIndex+len(lengthFormat)]
+// Expected responses
 
-	count, err := strconv.Atoi(numberStr)
-	if err != nil {
-		return nil
-	}
+var rotelSources = map[string]bool{
+	"cd": true, "coax1": true, "coax2": true, "opt1": true, "opt2": true,
+	"aux1": true, "aux2": true, "tuner": true, "phono": true, "usb": true,
+	"bluetooth": true, "pc_usb": true,
+}
 
-	substringStartIndex := numberStartIndex + len(lengthFormat) + 1 //1 for comma
+var rotelResponseKeys = map[string]string{
+	"power":          "power",
+	"volume":         "volume",
+	"mute":           "mute",
+	"source":         "source",
+	"freq":           "freq",
+	"tone":           "tone",
+	"bass":           "bass",
+	"treble":         "treble",
+	"balance":        "balance",
+	"display":        "display",
+	"display1":       "display1",
+	"display2":       "display2",
+	"display_update": "display_update",
+	"dimmer":         "dimmer",
+	"speaker":        "speaker",
+}
 
-	substringEndIndex := substringStartIndex + count
-	if substringEndIndex > len(input) {
-		return nil
+var rotelResponseValues = map[string]string{
+	"power_on":  "on",
+	"power_off": "standby",
+	"mute_on":   "on",
+	"mute_off":  "off",
+}
+
+// Returns the key and value of the response the Rotel sends after the
+// given command, e.g. "power" and "on" for "power_on!". The value is ""
+// if any value is accepted, such as for toggles and queries, and the key
+// is "" if the response is unknown.
+func expectedResponse(command string) (string, string) {
+	if strings.Count(command, "!") != 1 || !strings.HasSuffix(command, "!") {
+		return "", ""
 	}
+	command = strings.TrimSuffix(command, "!")
+	if rotelSources[command] {
+		return "source", command
+	}
+	if value, exists := rotelResponseValues[command]; exists {
+		return command[:strings.Index(command, "_")], value
+	}
+	if volume, found := strings.CutPrefix(command, "volume_"); found && parseRotelVolume(volume) != nil {
+		return "volume", volume
+	}
+	command = strings.TrimPrefix(command, "get_")
+	command = strings.TrimPrefix(command, "current_")
+	if key, exists := rotelResponseKeys[command]; exists {
+		return key, ""
+	}
+	if strings.HasPrefix(command, "display_update") {
+		return "display_update", ""
+	}
+	if pos := strings.Index(command, "_"); pos != -1 {
+		if key, exists := rotelResponseKeys[command[:pos]]; exists {
+			return key, ""
+		}
+	}
+	return "", ""
+}
 
-	result := input[substringStartIndex:substringEndIndex]
-	return &result
+// Returns true if the response value is the expected one, volumes are
+// compared numerically as the Rotel reports e.g. "05" as "5" or "min"
+func responseValueMatches(key, expected, value string) bool {
+	if expected == "" {
+		return true
+	}
+	if key == "volume" {
+		e, v := parseRotelVolume(expected), parseRotelVolume(value)
+		return e != nil && v != nil && *e == *v
+	}
+	return expected == value
 }
 
-func (rdp *RotelDataParser) match(s string) (bool, string) {
+// Value parsing
 
-	if matchCommand(s) {
-		return true, s
-	} else {
-		displayMatch := matchDisplay("display1=XX", s)
-		if displayMatch != nil {
-			return true, "display1=" + *displayMatch + "!"
-		}
-		displayMatch = matchDisplay("display2=XX", s)
-		if displayMatch != nil {
-			return true, "display2=" + *displayMatch + "!"
-		}
-		displayMatch = matchDisplay("display=XXX", s)
-		if displayMatch != nil {
-			return true, "display=" + *displayMatch + "!"
-		}
+func parseRotelVolume(s string) *int {
+	switch s {
+	case "min":
+		v := 0
+		return &v
+	case "max":
+		v := 96
+		return &v
 	}
-	return false, s
+	return parseRotelTone(s)
 }
 
-func (rdp *RotelDataParser) HandleParsedData(data string) {
-	rdp.buffer += string(data)
-	next := ""
-outer:
-	for len(rdp.buffer) > 0 {
-		for i, c := range rdp.buffer {
-			next += string(c)
-			match, matchedString := rdp.match(next)
-			if match {
-				rdp.PushKeyValuePair(matchedString)
-				next = ""
-				rdp.buffer = rdp.buffer[i+1:]
-				continue outer
-			}
-		}
-		break
+// Tone values are reported as "000", "-02" or "+03"
+func parseRotelTone(s string) *int {
+	if s == "" {
+		return nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// Balance is reported as "000", "L05" or "R03", left being negative
+func parseRotelBalance(s string) *int {
+	if s == "" {
+		return nil
+	}
+	sign := 1
+	switch s[0] {
+	case 'L', 'l':
+		sign = -1
+		s = s[1:]
+	case 'R', 'r':
+		s = s[1:]
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return nil
+	}
+	v = sign * v
+	return &v
+}
+
+// Frequency is reported in kHz, or "off" when not applicable
+func parseRotelFreq(s string) *float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
 	}
+	return &v
 }
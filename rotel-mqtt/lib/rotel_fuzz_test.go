@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parseAll(chunks ...string) [][]string {
+	r := NewRotelDataParser()
+	for _, chunk := range chunks {
+		r.HandleParsedData(chunk)
+	}
+	return r.RotelDataQueue
+}
+
+func FuzzHandleParsedData(f *testing.F) {
+	f.Add("source=coax2!freq=44.1!")
+	f.Add("display=010,0123456789A")
+	f.Add("display1=20,  COAX1      VOL 39 display2=20, BASS 0     TREB 0  volume=39!")
+	f.Add(" PCM    volume=39!source=opt1!fr")
+	f.Add("volume=39source=opt1!")
+	f.Add("display=999,")
+
+	f.Fuzz(func(t *testing.T, data string) {
+		r := NewRotelDataParser()
+		r.HandleParsedData(data)
+
+		if len(r.key) > maxKeyLength {
+			t.Errorf("key length %d exceeds %d", len(r.key), maxKeyLength)
+		}
+		if len(r.value) > maxValueLength && r.state != parseDisplayText {
+			t.Errorf("value length %d exceeds %d", len(r.value), maxValueLength)
+		}
+		if r.state == parseDisplayText && len(r.value) >= r.displayLength {
+			t.Errorf("display text length %d not below %d", len(r.value), r.displayLength)
+		}
+		for _, cmd := range r.RotelDataQueue {
+			if len(cmd) != 2 || cmd[0] == "" {
+				t.Errorf("malformed data %q", cmd)
+			}
+		}
+	})
+}
+
+func FuzzHandleParsedDataSplit(f *testing.F) {
+	f.Add("source=coax2!freq=44.1!display=010,0123456789A", 5)
+	f.Add("display1=04,abcdevolume=39!", 11)
+
+	f.Fuzz(func(t *testing.T, data string, split int) {
+		if split < 0 || split > len(data) {
+			return
+		}
+		whole := parseAll(data)
+		parts := parseAll(data[:split], data[split:])
+		if !reflect.DeepEqual(whole, parts) {
+			t.Errorf("split at %d gave %q, whole gave %q", split, parts, whole)
+		}
+	})
+}
+
+func FuzzHandleParsedDataRoundTrip(f *testing.F) {
+	f.Add("volume", "39", "  COAX1      VOL 39 ")
+	f.Add("freq", "44.1", "")
+
+	f.Fuzz(func(t *testing.T, key, value, display string) {
+		if key == "" || len(key) > maxKeyLength || isDisplayKey(key) ||
+			strings.IndexFunc(key, func(r rune) bool { return r > 0x7f || !isKeyByte(byte(r)) }) >= 0 ||
+			len(value) > maxValueLength || strings.ContainsAny(value, "=!") ||
+			len(display) > 99 {
+			return
+		}
+		result := parseAll(key + "=" + value + "!" + "display1=" + twoDigits(len(display)) + "," + display)
+		expected := [][]string{{key, value}, {"display1", display}}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("got %q, expected %q", result, expected)
+		}
+	})
+}
+
+func twoDigits(n int) string {
+	return string([]byte{byte('0' + n/10), byte('0' + n%10)})
+}
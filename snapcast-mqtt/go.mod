@@ -4,12 +4,12 @@ go 1.22.8
 
 require (
 	github.com/ConnorsApps/snapcast-go v0.2.0
+	github.com/claes/mqtt-bridges/common v0.0.0-20241218194001-0e0f35dcc1d1
 	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/gorilla/websocket v1.5.3
 )
 
 require (
-	github.com/claes/mqtt-bridges/common v0.0.0-20241218194001-0e0f35dcc1d1 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
 	golang.org/x/net v0.27.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 	golang.org/x/time v0.5.0 // indirect
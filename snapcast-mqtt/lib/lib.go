@@ -2,9 +2,15 @@ package lib
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log/slog"
+	"reflect"
 	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 
@@ -18,13 +24,22 @@ type SnapcastMQTTBridge struct {
 	common.BaseMQTTBridge
 	SnapClient       *snapclient.Client
 	SnapClientConfig SnapClientConfig
-	ServerStatus     SnapcastServer
+	// Written by the event loop, read by the MQTT handlers under statusMutex
+	ServerStatus SnapcastServer
+	statusMutex  sync.Mutex
 
 	sendMutex sync.Mutex
+	refresh   chan struct{}
+	republish bool
+
+	watcherMutex sync.Mutex
+	watcher      *SnapcastWatcher
 }
 
 type SnapClientConfig struct {
 	SnapServerAddress string
+	// Interval of full status refreshes, 0 to only refresh on inconsistencies
+	RefreshInterval time.Duration
 }
 
 func CreateSnapclient(config SnapClientConfig) (*snapclient.Client, error) {
@@ -50,11 +65,25 @@ func NewSnapcastMQTTBridge(snapClientConfig SnapClientConfig, mqttClient mqtt.Cl
 		},
 		SnapClient:       snapClient,
 		SnapClientConfig: snapClientConfig,
+		refresh:          make(chan struct{}, 1),
 	}
 
 	funcs := map[string]func(client mqtt.Client, message mqtt.Message){
 		"snapcast/group/+/stream/set":  bridge.onGroupStreamSet,
 		"snapcast/client/+/stream/set": bridge.onClientStreamSet,
+
+		"snapcast/client/+/volume/set":  bridge.onClientVolumeSet,
+		"snapcast/client/+/mute/set":    bridge.onClientMuteSet,
+		"snapcast/client/+/latency/set": bridge.onClientLatencySet,
+		"snapcast/client/+/name/set":    bridge.onClientNameSet,
+
+		"snapcast/group/+/clients/set": bridge.onGroupClientsSet,
+		"snapcast/group/+/mute/set":    bridge.onGroupMuteSet,
+		"snapcast/group/+/name/set":    bridge.onGroupNameSet,
+
+		"snapcast/stream/+/control": bridge.onStreamControl,
+		"snapcast/streams/add":      bridge.onStreamAdd,
+		"snapcast/stream/+/remove":  bridge.onStreamRemove,
 	}
 	for key, function := range funcs {
 		token := mqttClient.Subscribe(common.Prefixify(topicPrefix, key), 0, function)
@@ -105,7 +134,7 @@ func (bridge *SnapcastMQTTBridge) onClientStreamSet(client mqtt.Client, message
 		streamId := string(message.Payload())
 		if streamId != "" {
 			clientId := matches[1]
-			client, exists := bridge.ServerStatus.Clients[clientId]
+			client, exists := bridge.client(clientId)
 			if !exists {
 				slog.Error("Client not found", "clientId", clientId)
 				return
@@ -131,9 +160,339 @@ func (bridge *SnapcastMQTTBridge) onClientStreamSet(client mqtt.Client, message
 	}
 }
 
+var setTopic = regexp.MustCompile(`snapcast/(client|group)/([^/]+)/([^/]+)/set$`)
+
+// Sends a request to the Snapcast server and parses its result
+func sendRequest[T any](bridge *SnapcastMQTTBridge, method snapcast.RequestMethod, params any) (*T, error) {
+	res, err := bridge.SnapClient.Send(context.Background(), method, params)
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, fmt.Errorf("%s: %s", method, res.Error.Message)
+	}
+	return snapcast.ParseResult[T](res.Result)
+}
+
+// Returns the client or group id of a snapcast/<client|group>/<id>/<command>/set
+// message, clearing the command topic
+func (bridge *SnapcastMQTTBridge) setMessage(message mqtt.Message) (string, bool) {
+	matches := setTopic.FindStringSubmatch(message.Topic())
+	if matches == nil || len(message.Payload()) == 0 {
+		return "", false
+	}
+	kind, id, command := matches[1], matches[2], matches[3]
+	bridge.PublishStringMQTT("snapcast/"+kind+"/"+id+"/"+command+"/set", "", false)
+	return id, true
+}
+
+// Returns the cached status of a client
+func (bridge *SnapcastMQTTBridge) client(clientID string) (SnapcastClient, bool) {
+	bridge.statusMutex.Lock()
+	defer bridge.statusMutex.Unlock()
+	client, exists := bridge.ServerStatus.Clients[clientID]
+	return client, exists
+}
+
+// Asks the event loop to refetch and republish the server status
+func (bridge *SnapcastMQTTBridge) requestRefresh() {
+	select {
+	case bridge.refresh <- struct{}{}:
+	default:
+	}
+}
+
+func (bridge *SnapcastMQTTBridge) onClientVolumeSet(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	clientId, ok := bridge.setMessage(message)
+	if !ok {
+		return
+	}
+	percent, err := strconv.Atoi(string(message.Payload()))
+	if err != nil || percent < 0 || percent > 100 {
+		slog.Error("Invalid client volume", "payload", string(message.Payload()), "clientId", clientId, "error", err)
+		return
+	}
+	current, exists := bridge.client(clientId)
+	if !exists {
+		slog.Error("Client not found", "clientId", clientId)
+		return
+	}
+	// Client.SetVolume sets both, keep the current mute state
+	volume := snapcast.Volume{
+		Muted:   current.Muted,
+		Percent: percent,
+	}
+	_, err = sendRequest[snapcast.ClientSetVolumeResponse](bridge, snapcast.MethodClientSetVolume,
+		&snapcast.ClientSetVolumeRequest{ID: clientId, Volume: volume})
+	if err != nil {
+		slog.Error("Error when setting client volume", "error", err, "volume", percent, "clientId", clientId)
+	}
+}
+
+func (bridge *SnapcastMQTTBridge) onClientMuteSet(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	clientId, ok := bridge.setMessage(message)
+	if !ok {
+		return
+	}
+	muted, err := strconv.ParseBool(string(message.Payload()))
+	if err != nil {
+		slog.Error("Invalid client mute", "payload", string(message.Payload()), "clientId", clientId, "error", err)
+		return
+	}
+	current, exists := bridge.client(clientId)
+	if !exists {
+		slog.Error("Client not found", "clientId", clientId)
+		return
+	}
+	volume := snapcast.Volume{
+		Muted:   muted,
+		Percent: int(current.Volume),
+	}
+	_, err = sendRequest[snapcast.ClientSetVolumeResponse](bridge, snapcast.MethodClientSetVolume,
+		&snapcast.ClientSetVolumeRequest{ID: clientId, Volume: volume})
+	if err != nil {
+		slog.Error("Error when setting client mute", "error", err, "muted", muted, "clientId", clientId)
+	}
+}
+
+func (bridge *SnapcastMQTTBridge) onClientLatencySet(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	clientId, ok := bridge.setMessage(message)
+	if !ok {
+		return
+	}
+	latency, err := strconv.Atoi(string(message.Payload()))
+	if err != nil {
+		slog.Error("Invalid client latency", "payload", string(message.Payload()), "clientId", clientId, "error", err)
+		return
+	}
+	_, err = sendRequest[snapcast.ClientSetLatencyResponse](bridge, snapcast.MethodClientSetLatency,
+		&snapcast.ClientSetLatencyRequest{ID: clientId, Latency: latency})
+	if err != nil {
+		slog.Error("Error when setting client latency", "error", err, "latency", latency, "clientId", clientId)
+	}
+}
+
+func (bridge *SnapcastMQTTBridge) onClientNameSet(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	clientId, ok := bridge.setMessage(message)
+	if !ok {
+		return
+	}
+	name := string(message.Payload())
+	_, err := sendRequest[snapcast.ClientSetNameResponse](bridge, snapcast.MethodClientSetName,
+		&snapcast.ClientSetNameRequest{ID: clientId, Name: name})
+	if err != nil {
+		slog.Error("Error when setting client name", "error", err, "name", name, "clientId", clientId)
+	}
+}
+
+func (bridge *SnapcastMQTTBridge) onGroupClientsSet(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	groupId, ok := bridge.setMessage(message)
+	if !ok {
+		return
+	}
+	var clients []string
+	err := json.Unmarshal(message.Payload(), &clients)
+	if err != nil {
+		slog.Error("Invalid group clients", "payload", string(message.Payload()), "groupId", groupId, "error", err)
+		return
+	}
+	// The result of Group.SetClients is the full server status
+	_, err = sendRequest[snapcast.ServerGetStatusResponse](bridge, snapcast.MethodGroupSetClients,
+		&snapcast.GroupSetClientsRequest{ID: groupId, Clients: clients})
+	if err != nil {
+		slog.Error("Error when setting group clients", "error", err, "clients", clients, "groupId", groupId)
+		return
+	}
+	bridge.requestRefresh()
+}
+
+func (bridge *SnapcastMQTTBridge) onGroupMuteSet(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	groupId, ok := bridge.setMessage(message)
+	if !ok {
+		return
+	}
+	muted, err := strconv.ParseBool(string(message.Payload()))
+	if err != nil {
+		slog.Error("Invalid group mute", "payload", string(message.Payload()), "groupId", groupId, "error", err)
+		return
+	}
+	_, err = sendRequest[snapcast.GroupSetMuteResponse](bridge, snapcast.MethodGroupSetMute,
+		&snapcast.GroupSetMuteRequest{ID: groupId, Muted: muted})
+	if err != nil {
+		slog.Error("Error when setting group mute", "error", err, "muted", muted, "groupId", groupId)
+	}
+}
+
+func (bridge *SnapcastMQTTBridge) onGroupNameSet(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	groupId, ok := bridge.setMessage(message)
+	if !ok {
+		return
+	}
+	name := string(message.Payload())
+	_, err := sendRequest[snapcast.GroupSetNameResponse](bridge, snapcast.MethodGroupSetName,
+		&snapcast.GroupSetNameRequest{ID: groupId, Name: name})
+	if err != nil {
+		slog.Error("Error when setting group name", "error", err, "name", name, "groupId", groupId)
+	}
+}
+
+var streamControlTopic = regexp.MustCompile(`snapcast/stream/([^/]+)/control$`)
+
+// Payload of snapcast/stream/<id>/control, which may also be just the command,
+// such as play, pause, playPause, stop, next, previous, seek or setPosition
+type SnapcastStreamControl struct {
+	Command string `json:"command"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// Stream.Control parameters, as snapcast.StreamControl lacks the stream id
+type streamControlRequest struct {
+	ID      string `json:"id"`
+	Command string `json:"command"`
+	Params  any    `json:"params,omitempty"`
+}
+
+func (bridge *SnapcastMQTTBridge) onStreamControl(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	matches := streamControlTopic.FindStringSubmatch(message.Topic())
+	payload := strings.TrimSpace(string(message.Payload()))
+	if matches == nil || payload == "" {
+		return
+	}
+	streamId := matches[1]
+	bridge.PublishStringMQTT("snapcast/stream/"+streamId+"/control", "", false)
+
+	control := SnapcastStreamControl{Command: payload}
+	if strings.HasPrefix(payload, "{") {
+		control = SnapcastStreamControl{}
+		err := json.Unmarshal([]byte(payload), &control)
+		if err != nil || control.Command == "" {
+			slog.Error("Invalid stream control", "payload", payload, "streamId", streamId, "error", err)
+			return
+		}
+	}
+	_, err := sendRequest[snapcast.StreamControlResponse](bridge, snapcast.MethodStreamControl,
+		&streamControlRequest{ID: streamId, Command: control.Command, Params: control.Params})
+	if err != nil {
+		slog.Error("Error when controlling stream", "error", err, "command", control.Command, "streamId", streamId)
+	}
+}
+
+var streamRemoveTopic = regexp.MustCompile(`snapcast/stream/([^/]+)/remove$`)
+
+// Published on snapcast/streams/result for each stream add or remove
+type SnapcastStreamResult struct {
+	Command  string `json:"command"` // add, remove
+	StreamID string `json:"stream_id,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (bridge *SnapcastMQTTBridge) publishStreamResult(result SnapcastStreamResult, err error) {
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Success = err == nil
+	bridge.PublishJSONMQTT("snapcast/streams/result", result, false)
+}
+
+func (bridge *SnapcastMQTTBridge) onStreamAdd(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	if len(message.Payload()) == 0 {
+		return
+	}
+	bridge.PublishStringMQTT("snapcast/streams/add", "", false)
+
+	var spec SnapcastStreamSpec
+	err := json.Unmarshal(message.Payload(), &spec)
+	if err != nil {
+		slog.Error("Invalid stream spec", "payload", string(message.Payload()), "error", err)
+		bridge.publishStreamResult(SnapcastStreamResult{Command: "add"}, err)
+		return
+	}
+	uri, err := spec.StreamURI()
+	if err != nil {
+		slog.Error("Invalid stream spec", "payload", string(message.Payload()), "error", err)
+		bridge.publishStreamResult(SnapcastStreamResult{Command: "add"}, err)
+		return
+	}
+
+	res, err := sendRequest[snapcast.StreamAddStreamResponse](bridge, snapcast.MethodStreamAddStream,
+		&snapcast.StreamAddStream{StreamUri: uri})
+	result := SnapcastStreamResult{Command: "add", URI: uri}
+	if err != nil {
+		slog.Error("Error when adding stream", "error", err, "uri", uri)
+	} else {
+		result.StreamID = res.StreamId
+		bridge.requestRefresh()
+	}
+	bridge.publishStreamResult(result, err)
+}
+
+func (bridge *SnapcastMQTTBridge) onStreamRemove(client mqtt.Client, message mqtt.Message) {
+	bridge.sendMutex.Lock()
+	defer bridge.sendMutex.Unlock()
+
+	matches := streamRemoveTopic.FindStringSubmatch(message.Topic())
+	if matches == nil || len(message.Payload()) == 0 {
+		return
+	}
+	streamId := matches[1]
+	bridge.PublishStringMQTT("snapcast/stream/"+streamId+"/remove", "", false)
+
+	_, err := sendRequest[snapcast.StreamRemoveStreamResponse](bridge, snapcast.MethodStreamRemoveStream,
+		&snapcast.StreamRemoveStream{ID: streamId})
+	if err != nil {
+		slog.Error("Error when removing stream", "error", err, "streamId", streamId)
+	} else {
+		bridge.requestRefresh()
+	}
+	bridge.publishStreamResult(SnapcastStreamResult{Command: "remove", StreamID: streamId}, err)
+}
+
 func (bridge *SnapcastMQTTBridge) publishServerStatus(serverStatus SnapcastServer, publishGroup, publishClient, publishStream bool) {
 
-	// TODO: Delete what no longer exist?
+	// Clear retained topics of what no longer exist
+	for _, groupID := range removedKeys(bridge.ServerStatus.Groups, serverStatus.Groups) {
+		bridge.PublishStringMQTT("snapcast/group/"+groupID, "", true)
+	}
+	for _, clientID := range removedKeys(bridge.ServerStatus.Clients, serverStatus.Clients) {
+		bridge.PublishStringMQTT("snapcast/client/"+clientID, "", true)
+	}
+	for _, streamID := range removedKeys(bridge.ServerStatus.Streams, serverStatus.Streams) {
+		bridge.PublishStringMQTT("snapcast/stream/"+streamID, "", true)
+	}
+
+	index := serverStatus.Index()
+	if bridge.ServerStatus.Groups == nil || bridge.republish || !reflect.DeepEqual(bridge.ServerStatus.Index(), index) {
+		bridge.PublishJSONMQTT("snapcast/index", index, true)
+	}
 
 	if publishGroup {
 		for _, group := range serverStatus.Groups {
@@ -154,9 +513,9 @@ func (bridge *SnapcastMQTTBridge) publishServerStatus(serverStatus SnapcastServe
 
 func (bridge *SnapcastMQTTBridge) publishStreamStatus(streamStatus SnapcastStream) {
 	publish := false
-	if bridge.ServerStatus.Clients != nil {
+	if bridge.ServerStatus.Streams != nil && !bridge.republish {
 		currentStreamStatus, exists := bridge.ServerStatus.Streams[streamStatus.StreamID]
-		publish = !(exists && currentStreamStatus == streamStatus)
+		publish = !(exists && reflect.DeepEqual(currentStreamStatus, streamStatus))
 	} else {
 		publish = true
 	}
@@ -168,7 +527,7 @@ func (bridge *SnapcastMQTTBridge) publishStreamStatus(streamStatus SnapcastStrea
 
 func (bridge *SnapcastMQTTBridge) publishClientStatus(clientStatus SnapcastClient) {
 	publish := false
-	if bridge.ServerStatus.Clients != nil {
+	if bridge.ServerStatus.Clients != nil && !bridge.republish {
 		currentClientStatus, exists := bridge.ServerStatus.Clients[clientStatus.ClientID]
 		publish = !(exists && currentClientStatus == clientStatus)
 	} else {
@@ -182,7 +541,7 @@ func (bridge *SnapcastMQTTBridge) publishClientStatus(clientStatus SnapcastClien
 
 func (bridge *SnapcastMQTTBridge) publishGroupStatus(groupStatus SnapcastGroup) {
 	publish := false
-	if bridge.ServerStatus.Groups != nil {
+	if bridge.ServerStatus.Groups != nil && !bridge.republish {
 		currentGroupStatus, exists := bridge.ServerStatus.Groups[groupStatus.GroupID]
 		publish = !(exists && snapcastGroupsEqual(currentGroupStatus, groupStatus))
 	} else {
@@ -194,111 +553,283 @@ func (bridge *SnapcastMQTTBridge) publishGroupStatus(groupStatus SnapcastGroup)
 	}
 }
 
-func (bridge *SnapcastMQTTBridge) processServerStatus(ctx context.Context, publishGroup, publishClient, publishStream bool) {
+func (bridge *SnapcastMQTTBridge) processServerStatus(ctx context.Context, publishGroup, publishClient, publishStream bool) error {
 
 	res, err := bridge.SnapClient.Send(ctx, snapcast.MethodServerGetStatus, struct{}{})
 	if err != nil {
 		slog.Error("Error when requesting server status", "error", err)
+		return err
 	}
 	if res.Error != nil {
 		slog.Error("Error in response to server get status", "error", res.Error)
+		return fmt.Errorf("%s: %s", snapcast.MethodServerGetStatus, res.Error.Message)
 	}
 
 	serverStatusRes, err := snapcast.ParseResult[snapcast.ServerGetStatusResponse](res.Result)
 	if err != nil {
-		slog.Error("Error when parsing server status response", "error", res.Error)
+		slog.Error("Error when parsing server status response", "error", err)
+		return err
 	}
 
 	serverStatus, err := parseServerStatus(serverStatusRes)
 	if err != nil {
 		slog.Error("Error when parsing server status ", "error", err)
+		return err
+	}
+
+	streamsRes, err := snapcast.ParseResult[serverStreamsResponse](res.Result)
+	if err != nil {
+		slog.Error("Error when parsing server stream properties", "error", err)
+		return err
+	}
+	for streamID, properties := range parseStreamProperties(streamsRes) {
+		stream := serverStatus.Streams[streamID]
+		stream.Properties = properties
+		serverStatus.Streams[streamID] = stream
 	}
 
+	bridge.statusMutex.Lock()
+	defer bridge.statusMutex.Unlock()
 	bridge.publishServerStatus(*serverStatus, publishGroup, publishClient, publishStream)
 	bridge.ServerStatus = *serverStatus
+	bridge.republish = false
+	return nil
 }
 
-func (bridge *SnapcastMQTTBridge) processGroupStatus(ctx context.Context, groupID string) {
+// Applies a notification to the cached client and publishes the client and
+// its group, or refreshes the full status if the client is unknown
+func (bridge *SnapcastMQTTBridge) applyClientUpdate(ctx context.Context, clientID string, update func(*SnapcastClient)) error {
+	bridge.statusMutex.Lock()
+	client, group, exists := bridge.ServerStatus.updateClient(clientID, update)
+	if exists {
+		bridge.PublishJSONMQTT("snapcast/client/"+client.ClientID, client, true)
+		bridge.PublishJSONMQTT("snapcast/group/"+group.GroupID, group, true)
+	}
+	bridge.statusMutex.Unlock()
 
-	res, err := bridge.SnapClient.Send(ctx, snapcast.MethodGroupGetStatus, &snapcast.GroupGetStatusRequest{ID: groupID})
-	if err != nil {
-		slog.Error("Error when requesting group status", "error", err)
+	if !exists {
+		slog.Debug("Notification for unknown client, refreshing status", "clientId", clientID)
+		return bridge.processServerStatus(ctx, true, true, true)
 	}
-	if res.Error != nil {
-		slog.Error("Error in response to group get status", "error", res.Error)
+	return nil
+}
+
+// Applies a notification to the cached group and publishes the group and
+// its clients, or refreshes the full status if the group is unknown
+func (bridge *SnapcastMQTTBridge) applyGroupUpdate(ctx context.Context, groupID string, update func(*SnapcastGroup)) error {
+	bridge.statusMutex.Lock()
+	group, exists := bridge.ServerStatus.updateGroup(groupID, update)
+	if exists {
+		bridge.PublishJSONMQTT("snapcast/group/"+group.GroupID, group, true)
+		for _, client := range group.Clients {
+			bridge.PublishJSONMQTT("snapcast/client/"+client.ClientID, client, true)
+		}
 	}
+	bridge.statusMutex.Unlock()
 
-	groupStatusRes, err := snapcast.ParseResult[snapcast.GroupGetStatusResponse](res.Result)
-	if err != nil {
-		slog.Error("Error when parsing group status response", "error", res.Error)
+	if !exists {
+		slog.Debug("Notification for unknown group, refreshing status", "groupId", groupID)
+		return bridge.processServerStatus(ctx, true, true, true)
 	}
+	return nil
+}
 
-	groupStatus, err := parseGroupStatus(&groupStatusRes.Group)
-	if err != nil {
-		slog.Error("Error when parsing group status ", "error", err)
+// Applies a notification to the cached stream and publishes it, or
+// refreshes the full status if the stream is unknown
+func (bridge *SnapcastMQTTBridge) applyStreamUpdate(ctx context.Context, streamID string, update func(*SnapcastStream)) error {
+	bridge.statusMutex.Lock()
+	stream, exists := bridge.ServerStatus.updateStream(streamID, update)
+	if exists {
+		bridge.PublishJSONMQTT("snapcast/stream/"+stream.StreamID, stream, true)
 	}
+	bridge.statusMutex.Unlock()
 
-	bridge.publishGroupStatus(*groupStatus)
-	bridge.ServerStatus.Groups[groupStatus.GroupID] = *groupStatus
+	if !exists {
+		slog.Debug("Notification for unknown stream, refreshing status", "streamId", streamID)
+		return bridge.processServerStatus(ctx, true, true, true)
+	}
+	return nil
 }
 
+const (
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = time.Minute
+)
+
+// Connects to the Snapcast server, publishes its status and handles
+// notifications, reconnecting with backoff whenever the connection is lost,
+// until ctx is done
 func (bridge *SnapcastMQTTBridge) EventLoop(ctx context.Context) {
+	backoff := minReconnectBackoff
+	for {
+		err := bridge.listen(ctx, func() { backoff = minReconnectBackoff })
+		if ctx.Err() != nil {
+			slog.Info("Closing down SnapcastMQTTBridge event loop")
+			return
+		}
+		slog.Error("Snapcast connection lost", "error", err, "retryIn", backoff)
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Closing down SnapcastMQTTBridge event loop")
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxReconnectBackoff)
+	}
+}
+
+// Replaces the current watcher, closing the previous one
+func (bridge *SnapcastMQTTBridge) setWatcher(watcher *SnapcastWatcher) {
+	bridge.watcherMutex.Lock()
+	defer bridge.watcherMutex.Unlock()
+
+	if bridge.watcher != nil {
+		bridge.watcher.Close()
+	}
+	bridge.watcher = watcher
+}
+
+// Closes the websocket connection to the Snapcast server, if connected
+func (bridge *SnapcastMQTTBridge) Close() {
+	bridge.setWatcher(nil)
+}
 
-	var notify = &snapclient.Notifications{
-		MsgReaderErr:          make(chan error),
-		StreamOnUpdate:        make(chan *snapcast.StreamOnUpdate),
-		ServerOnUpdate:        make(chan *snapcast.ServerOnUpdate),
-		GroupOnMute:           make(chan *snapcast.GroupOnMute),
-		GroupOnNameChanged:    make(chan *snapcast.GroupOnNameChanged),
-		GroupOnStreamChanged:  make(chan *snapcast.GroupOnStreamChanged),
-		ClientOnVolumeChanged: make(chan *snapcast.ClientOnVolumeChanged),
-		ClientOnNameChanged:   make(chan *snapcast.ClientOnNameChanged),
-		ClientOnConnect:       make(chan *snapcast.ClientOnConnect),
-		ClientOnDisconnect:    make(chan *snapcast.ClientOnDisconnect),
+// Listens for notifications, refetches and republishes the full server
+// status, and then handles notifications until the connection is lost or
+// ctx is done. connected is called once the server status has been
+// published.
+func (bridge *SnapcastMQTTBridge) listen(ctx context.Context, connected func()) error {
+
+	watcher, err := NewSnapcastWatcher(bridge.SnapClientConfig)
+	if err != nil {
+		slog.Error("Error connecting to Snapcast notifications", "error", err)
+		return err
 	}
+	bridge.setWatcher(watcher)
+	defer bridge.setWatcher(nil)
 
-	wsClose, err := bridge.SnapClient.Listen(notify)
+	bridge.republish = true
+	err = bridge.processServerStatus(ctx, true, true, true)
 	if err != nil {
-		slog.Error("Error listening for notifications on snapclient", "error", err)
+		return err
 	}
-	defer close(wsClose)
+	connected()
 
-	bridge.processServerStatus(ctx, true, true, true)
+	var refreshTicker <-chan time.Time
+	if bridge.SnapClientConfig.RefreshInterval > 0 {
+		ticker := time.NewTicker(bridge.SnapClientConfig.RefreshInterval)
+		defer ticker.Stop()
+		refreshTicker = ticker.C
+	}
 
 	for {
 		select {
-
-		case <-notify.StreamOnUpdate:
-			bridge.processServerStatus(ctx, false, false, true)
-
-		case <-notify.ClientOnConnect:
-			bridge.processServerStatus(ctx, false, true, false)
-		case <-notify.ClientOnDisconnect:
-			bridge.processServerStatus(ctx, false, true, false)
-		case <-notify.ClientOnNameChanged:
-			bridge.processServerStatus(ctx, false, true, false)
-		case <-notify.ClientOnVolumeChanged:
-			bridge.processServerStatus(ctx, false, true, false) //todo update value directly?
-
-		case m := <-notify.GroupOnMute:
-			bridge.processGroupStatus(ctx, m.ID) //todo update value directly?
-		case <-notify.GroupOnNameChanged:
-			bridge.processServerStatus(ctx, true, true, false)
-		case <-notify.GroupOnStreamChanged:
-			bridge.processServerStatus(ctx, true, true, false)
-
-		case <-notify.ServerOnUpdate:
-			bridge.processServerStatus(ctx, true, true, true)
-		case m := <-notify.MsgReaderErr:
-			slog.Debug("Message reader error", "error", m.Error())
-			continue
+		case msg := <-watcher.Notification:
+			err = bridge.handleNotification(ctx, msg)
+		case <-refreshTicker:
+			err = bridge.processServerStatus(ctx, true, true, true)
+		case <-bridge.refresh:
+			err = bridge.processServerStatus(ctx, true, true, true)
 
 		case <-ctx.Done():
-			slog.Info("Closing down SnapcastMQTTBridge event loop")
-			return
-		case <-wsClose:
-			slog.Info("Snapclient connection closed")
-			//TODO: Initiate reconnect?
+			return ctx.Err()
+		case err := <-watcher.Error:
+			return err
+		}
+		if err != nil {
+			return err
 		}
 	}
 }
+
+// Applies a notification to the cached server status and publishes what
+// changed. Returns an error only if refetching the server status failed.
+func (bridge *SnapcastMQTTBridge) handleNotification(ctx context.Context, msg *snapcast.Notification) error {
+	var err error
+	switch *msg.Method {
+
+	case snapcast.MethodStreamOnUpdate:
+		var m *snapcast.StreamOnUpdate
+		if m, err = parseNotification[snapcast.StreamOnUpdate](msg); err == nil {
+			return bridge.applyStreamUpdate(ctx, m.ID, func(stream *SnapcastStream) {
+				stream.Status = string(m.Stream.Status)
+			})
+		}
+	case snapcast.MethodStreamOnProperties:
+		var m *streamOnProperties
+		if m, err = parseNotification[streamOnProperties](msg); err == nil {
+			return bridge.applyStreamUpdate(ctx, m.ID, func(stream *SnapcastStream) {
+				stream.Properties = m.Properties
+			})
+		}
+
+	case snapcast.MethodClientOnConnect:
+		var m *snapcast.ClientOnConnect
+		if m, err = parseNotification[snapcast.ClientOnConnect](msg); err == nil {
+			return bridge.applyClientUpdate(ctx, m.ID, func(client *SnapcastClient) {
+				updateClient(client, m.Client)
+				client.Connected = true
+			})
+		}
+	case snapcast.MethodClientOnDisconnect:
+		var m *snapcast.ClientOnDisconnect
+		if m, err = parseNotification[snapcast.ClientOnDisconnect](msg); err == nil {
+			return bridge.applyClientUpdate(ctx, m.ID, func(client *SnapcastClient) {
+				updateClient(client, m.Client)
+				client.Connected = false
+			})
+		}
+	case snapcast.MethodClientOnNameChanged:
+		var m *snapcast.ClientOnNameChanged
+		if m, err = parseNotification[snapcast.ClientOnNameChanged](msg); err == nil {
+			return bridge.applyClientUpdate(ctx, m.ID, func(client *SnapcastClient) {
+				client.Name = m.Name
+			})
+		}
+	case snapcast.MethodClientOnVolumeChanged:
+		var m *snapcast.ClientOnVolumeChanged
+		if m, err = parseNotification[snapcast.ClientOnVolumeChanged](msg); err == nil {
+			return bridge.applyClientUpdate(ctx, m.ID, func(client *SnapcastClient) {
+				client.Volume = float64(m.Volume.Percent)
+				client.Muted = m.Volume.Muted
+			})
+		}
+	case snapcast.MethodClientOnLatencyChanged:
+		var m *snapcast.ClientOnLatencyChanged
+		if m, err = parseNotification[snapcast.ClientOnLatencyChanged](msg); err == nil {
+			return bridge.applyClientUpdate(ctx, m.ID, func(client *SnapcastClient) {
+				client.Latency = m.Latency
+			})
+		}
+
+	case snapcast.MethodGroupOnMute:
+		var m *snapcast.GroupOnMute
+		if m, err = parseNotification[snapcast.GroupOnMute](msg); err == nil {
+			return bridge.applyGroupUpdate(ctx, m.ID, func(group *SnapcastGroup) {
+				group.Muted = m.Mute
+			})
+		}
+	case snapcast.MethodGroupOnNameChanged:
+		var m *snapcast.GroupOnNameChanged
+		if m, err = parseNotification[snapcast.GroupOnNameChanged](msg); err == nil {
+			return bridge.applyGroupUpdate(ctx, m.ID, func(group *SnapcastGroup) {
+				group.GroupName = m.Name
+			})
+		}
+	case snapcast.MethodGroupOnStreamChanged:
+		var m *snapcast.GroupOnStreamChanged
+		if m, err = parseNotification[snapcast.GroupOnStreamChanged](msg); err == nil {
+			return bridge.applyGroupUpdate(ctx, m.ID, func(group *SnapcastGroup) {
+				group.StreamID = m.StreamId
+			})
+		}
+
+	case snapcast.MethodServerOnUpdate:
+		return bridge.processServerStatus(ctx, true, true, true)
+	}
+	if err != nil {
+		slog.Error("Could not parse notification", "error", err, "method", *msg.Method)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/claes/mqtt-bridges/common/mqtttest"
+)
+
+const testServerStatus = `{
+	"groups": [
+		{"id": "g1", "name": "Kitchen", "muted": false, "stream_id": "s1", "clients": [
+			{"id": "c1", "connected": true, "host": {"name": "kitchen"},
+				"config": {"name": "", "latency": 0, "volume": {"muted": false, "percent": 40}}},
+			{"id": "c2", "connected": true, "host": {"name": "hall"},
+				"config": {"name": "Hall", "latency": 20, "volume": {"muted": false, "percent": 60}}}]},
+		{"id": "g2", "name": "Office", "muted": false, "stream_id": "s2", "clients": [
+			{"id": "c3", "connected": false, "host": {"name": "office"},
+				"config": {"name": "", "latency": 0, "volume": {"muted": true, "percent": 80}}}]}],
+	"streams": [
+		{"id": "s1", "status": "playing"},
+		{"id": "s2", "status": "idle"}]
+}`
+
+// The status after c3 joined g1 and s2 was removed
+const testServerStatusRegrouped = `{
+	"groups": [
+		{"id": "g1", "name": "Kitchen", "muted": false, "stream_id": "s1", "clients": [
+			{"id": "c1", "connected": true, "host": {"name": "kitchen"},
+				"config": {"name": "", "latency": 0, "volume": {"muted": false, "percent": 40}}},
+			{"id": "c2", "connected": true, "host": {"name": "hall"},
+				"config": {"name": "Hall", "latency": 20, "volume": {"muted": false, "percent": 60}}},
+			{"id": "c3", "connected": false, "host": {"name": "office"},
+				"config": {"name": "", "latency": 0, "volume": {"muted": true, "percent": 80}}}]}],
+	"streams": [
+		{"id": "s1", "status": "playing"}]
+}`
+
+func newTestBridge(t *testing.T, mock *mockSnapserver) (*SnapcastMQTTBridge, *mqtttest.Client) {
+	mqttClient := mqtttest.NewClient()
+	bridge, err := NewSnapcastMQTTBridge(SnapClientConfig{SnapServerAddress: mock.address()}, mqttClient, "")
+	if err != nil {
+		t.Fatalf("Could not create bridge: %v", err)
+	}
+	return bridge, mqttClient
+}
+
+func retainedJSON[T any](t *testing.T, mqttClient *mqtttest.Client, topic string) T {
+	t.Helper()
+	var obj T
+	payload, exists := mqttClient.Retained(topic)
+	if !exists {
+		t.Fatalf("Nothing retained on %s", topic)
+	}
+	if err := json.Unmarshal([]byte(payload), &obj); err != nil {
+		t.Fatalf("Could not unmarshal %s payload %q: %v", topic, payload, err)
+	}
+	return obj
+}
+
+func TestPublishServerStatus(t *testing.T) {
+	mock := newMockSnapserver(t, testServerStatus)
+	bridge, mqttClient := newTestBridge(t, mock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bridge.EventLoop(ctx)
+
+	waitFor(t, "index", func() bool {
+		_, exists := mqttClient.Retained("snapcast/index")
+		return exists
+	})
+
+	index := retainedJSON[SnapcastIndex](t, mqttClient, "snapcast/index")
+	if len(index.Groups) != 2 || len(index.Clients) != 3 || len(index.Streams) != 2 {
+		t.Errorf("Unexpected index %+v", index)
+	}
+	c2 := retainedJSON[SnapcastClient](t, mqttClient, "snapcast/client/c2")
+	expected := SnapcastClient{ClientID: "c2", Host: "hall", Name: "Hall", GroupID: "g1", GroupName: "Kitchen",
+		StreamID: "s1", Connected: true, Volume: 60, Latency: 20}
+	if c2 != expected {
+		t.Errorf("Unexpected client %+v, expected %+v", c2, expected)
+	}
+	g2 := retainedJSON[SnapcastGroup](t, mqttClient, "snapcast/group/g2")
+	if g2.StreamID != "s2" || len(g2.Clients) != 1 || !g2.Clients["c3"].Muted {
+		t.Errorf("Unexpected group %+v", g2)
+	}
+	s1 := retainedJSON[SnapcastStream](t, mqttClient, "snapcast/stream/s1")
+	if s1.Status != "playing" {
+		t.Errorf("Unexpected stream %+v", s1)
+	}
+}
+
+func TestNotificationsUpdateRetainedTopics(t *testing.T) {
+	mock := newMockSnapserver(t, testServerStatus)
+	bridge, mqttClient := newTestBridge(t, mock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bridge.EventLoop(ctx)
+
+	mock.waitConnected()
+	waitFor(t, "index", func() bool {
+		_, exists := mqttClient.Retained("snapcast/index")
+		return exists
+	})
+	statusRequests := len(mock.received("Server.GetStatus"))
+
+	// Applied to the cached status without refetching it
+	mock.notify("Client.OnVolumeChanged", map[string]any{"id": "c1", "volume": map[string]any{"muted": true, "percent": 10}})
+	waitFor(t, "client volume", func() bool {
+		c1 := retainedJSON[SnapcastClient](t, mqttClient, "snapcast/client/c1")
+		return c1.Muted && c1.Volume == 10
+	})
+	g1 := retainedJSON[SnapcastGroup](t, mqttClient, "snapcast/group/g1")
+	if g1.Clients["c1"].Volume != 10 {
+		t.Errorf("Group not republished with client volume %+v", g1)
+	}
+	mock.notify("Group.OnStreamChanged", map[string]any{"id": "g2", "stream_id": "s1"})
+	waitFor(t, "client stream", func() bool {
+		return retainedJSON[SnapcastClient](t, mqttClient, "snapcast/client/c3").StreamID == "s1"
+	})
+	mock.notify("Stream.OnProperties", map[string]any{"id": "s1", "properties": map[string]any{
+		"playbackStatus": "paused", "canControl": true, "metadata": map[string]any{"title": "Song"}}})
+	waitFor(t, "stream properties", func() bool {
+		properties := retainedJSON[SnapcastStream](t, mqttClient, "snapcast/stream/s1").Properties
+		return properties != nil && properties.PlaybackStatus == "paused" && properties.Metadata["title"] == "Song"
+	})
+	if requests := len(mock.received("Server.GetStatus")); requests != statusRequests {
+		t.Errorf("Expected no status refetch, got %d requests", requests-statusRequests)
+	}
+
+	// Removed entities have their retained topics cleared
+	mock.setStatus(testServerStatusRegrouped)
+	mock.notify("Server.OnUpdate", map[string]any{"server": map[string]any{}})
+	waitFor(t, "removed group", func() bool {
+		payload, _ := mqttClient.Retained("snapcast/group/g2")
+		return payload == ""
+	})
+	if payload, _ := mqttClient.Retained("snapcast/stream/s2"); payload != "" {
+		t.Errorf("Removed stream still retained %q", payload)
+	}
+	if payload, _ := mqttClient.Retained("snapcast/client/c3"); payload == "" {
+		t.Errorf("Moved client cleared")
+	}
+	index := retainedJSON[SnapcastIndex](t, mqttClient, "snapcast/index")
+	if len(index.Groups) != 1 || len(index.Clients) != 3 || len(index.Streams) != 1 {
+		t.Errorf("Unexpected index %+v", index)
+	}
+}
+
+func TestGroupStreamSet(t *testing.T) {
+	mock := newMockSnapserver(t, testServerStatus)
+	_, mqttClient := newTestBridge(t, mock)
+
+	mqttClient.Deliver("snapcast/group/+/stream/set", "snapcast/group/g1/stream/set", "s2")
+
+	requests := mock.received("Group.SetStream")
+	if len(requests) != 1 || requests[0].Params["id"] != "g1" || requests[0].Params["stream_id"] != "s2" {
+		t.Errorf("Unexpected Group.SetStream requests %+v", requests)
+	}
+	if payloads := mqttClient.Payloads("snapcast/group/g1/stream/set"); len(payloads) != 1 || payloads[0] != "" {
+		t.Errorf("Command topic not cleared %q", payloads)
+	}
+}
+
+func TestClientStreamSet(t *testing.T) {
+	mock := newMockSnapserver(t, testServerStatus)
+	bridge, mqttClient := newTestBridge(t, mock)
+
+	if err := bridge.processServerStatus(context.Background(), true, true, true); err != nil {
+		t.Fatalf("Could not process server status: %v", err)
+	}
+
+	// Switches the stream of the group of the client
+	mqttClient.Deliver("snapcast/client/+/stream/set", "snapcast/client/c3/stream/set", "s1")
+	requests := mock.received("Group.SetStream")
+	if len(requests) != 1 || requests[0].Params["id"] != "g2" || requests[0].Params["stream_id"] != "s1" {
+		t.Errorf("Unexpected Group.SetStream requests %+v", requests)
+	}
+
+	mqttClient.Deliver("snapcast/client/+/stream/set", "snapcast/client/unknown/stream/set", "s1")
+	if requests := mock.received("Group.SetStream"); len(requests) != 1 {
+		t.Errorf("Unexpected request for unknown client %+v", requests)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	mock := newMockSnapserver(t, testServerStatus)
+	bridge, mqttClient := newTestBridge(t, mock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bridge.EventLoop(ctx)
+
+	mock.waitConnected()
+	waitFor(t, "status", func() bool { return len(mock.received("Server.GetStatus")) == 1 })
+	mock.disconnect()
+
+	// The status is refetched after reconnecting, as notifications may
+	// have been missed
+	waitFor(t, "reconnect", func() bool { return mock.connections() == 2 })
+	waitFor(t, "status refetch", func() bool { return len(mock.received("Server.GetStatus")) == 2 })
+	mock.notify("Client.OnVolumeChanged", map[string]any{"id": "c2", "volume": map[string]any{"muted": false, "percent": 5}})
+	waitFor(t, "client volume", func() bool {
+		return retainedJSON[SnapcastClient](t, mqttClient, "snapcast/client/c2").Volume == 5
+	})
+}
+
+// Meant for go test -race, set requests read the cached status while
+// notifications update it
+func TestSetRequestsDuringNotifications(t *testing.T) {
+	mock := newMockSnapserver(t, testServerStatus)
+	bridge, mqttClient := newTestBridge(t, mock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bridge.EventLoop(ctx)
+
+	mock.waitConnected()
+	waitFor(t, "index", func() bool {
+		_, exists := mqttClient.Retained("snapcast/index")
+		return exists
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range 50 {
+			mock.notify("Client.OnVolumeChanged", map[string]any{"id": "c1", "volume": map[string]any{"muted": i%2 == 0, "percent": i}})
+			mock.notify("Group.OnStreamChanged", map[string]any{"id": "g1", "stream_id": []string{"s1", "s2"}[i%2]})
+		}
+	}()
+	// Few enough requests to stay within the burst of the snapclient rate limiter
+	go func() {
+		defer wg.Done()
+		for i := range 3 {
+			mqttClient.Deliver("snapcast/client/+/volume/set", "snapcast/client/c1/volume/set", strconv.Itoa(i))
+			mqttClient.Deliver("snapcast/client/+/mute/set", "snapcast/client/c1/mute/set", "true")
+			mqttClient.Deliver("snapcast/client/+/stream/set", "snapcast/client/c1/stream/set", "s2")
+		}
+	}()
+	wg.Wait()
+
+	if requests := mock.received("Client.SetVolume"); len(requests) != 6 {
+		t.Errorf("Expected 6 Client.SetVolume requests, got %d", len(requests))
+	}
+	if requests := mock.received("Group.SetStream"); len(requests) != 3 {
+		t.Errorf("Expected 3 Group.SetStream requests, got %d", len(requests))
+	}
+}
+
+func TestClientVolumeSet(t *testing.T) {
+	mock := newMockSnapserver(t, testServerStatus)
+	bridge, mqttClient := newTestBridge(t, mock)
+
+	if err := bridge.processServerStatus(context.Background(), true, true, true); err != nil {
+		t.Fatalf("Could not process server status: %v", err)
+	}
+
+	mqttClient.Deliver("snapcast/client/+/volume/set", "snapcast/client/c3/volume/set", "25")
+	requests := mock.received("Client.SetVolume")
+	expected := map[string]any{"muted": true, "percent": float64(25)}
+	if len(requests) != 1 || requests[0].Params["id"] != "c3" || !reflect.DeepEqual(requests[0].Params["volume"], expected) {
+		t.Errorf("Unexpected Client.SetVolume requests %+v", requests)
+	}
+
+	mqttClient.Deliver("snapcast/client/+/volume/set", "snapcast/client/unknown/volume/set", "25")
+	if requests := mock.received("Client.SetVolume"); len(requests) != 1 {
+		t.Errorf("Unexpected request for unknown client %+v", requests)
+	}
+}
+
+func TestStreamAdd(t *testing.T) {
+	mock := newMockSnapserver(t, testServerStatus)
+	_, mqttClient := newTestBridge(t, mock)
+
+	// Outside snapcast/stream/ so that no stream ID can collide with it
+	mqttClient.Deliver("snapcast/streams/add", "snapcast/streams/add", `{"uri": "pipe:///tmp/snapfifo?name=Doorbell"}`)
+
+	requests := mock.received("Stream.AddStream")
+	if len(requests) != 1 || requests[0].Params["streamUri"] != "pipe:///tmp/snapfifo?name=Doorbell" {
+		t.Errorf("Unexpected Stream.AddStream requests %+v", requests)
+	}
+	payloads := mqttClient.Payloads("snapcast/streams/result")
+	if len(payloads) != 1 {
+		t.Fatalf("Expected one result, got %q", payloads)
+	}
+	var result SnapcastStreamResult
+	if err := json.Unmarshal([]byte(payloads[0]), &result); err != nil || !result.Success || result.StreamID != "added" {
+		t.Errorf("Unexpected result %q, error %v", payloads[0], err)
+	}
+}
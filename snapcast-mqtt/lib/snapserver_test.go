@@ -0,0 +1,173 @@
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// A local stand-in for snapserver, serving JSON-RPC requests over HTTP and
+// pushing notifications over websocket like snapserver does on /jsonrpc
+type mockSnapserver struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mutex    sync.Mutex
+	status   map[string]any
+	requests []mockRequest
+	conns    []*websocket.Conn
+	accepted int
+}
+
+type mockRequest struct {
+	Method string         `json:"method"`
+	Params map[string]any `json:"params"`
+}
+
+func newMockSnapserver(t *testing.T, status string) *mockSnapserver {
+	mock := &mockSnapserver{t: t}
+	mock.setStatus(status)
+	mock.server = httptest.NewServer(http.HandlerFunc(mock.handle))
+	t.Cleanup(mock.close)
+	return mock
+}
+
+// Host and port to use as SnapServerAddress
+func (mock *mockSnapserver) address() string {
+	return strings.TrimPrefix(mock.server.URL, "http://")
+}
+
+// Sets the server status returned by Server.GetStatus, as the JSON
+// of its "server" object
+func (mock *mockSnapserver) setStatus(status string) {
+	var server map[string]any
+	if err := json.Unmarshal([]byte(status), &server); err != nil {
+		mock.t.Fatalf("Invalid mock server status: %v", err)
+	}
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+	mock.status = map[string]any{"server": server}
+}
+
+// Returns the requests received so far with the given method
+func (mock *mockSnapserver) received(method string) []mockRequest {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	var requests []mockRequest
+	for _, req := range mock.requests {
+		if req.Method == method {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+// Pushes a notification to all connected websocket clients
+func (mock *mockSnapserver) notify(method string, params any) {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+
+	for _, conn := range mock.conns {
+		err := conn.WriteJSON(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+		if err != nil {
+			mock.t.Errorf("Could not push notification %s: %v", method, err)
+		}
+	}
+}
+
+// Waits until a websocket client is connected
+func (mock *mockSnapserver) waitConnected() {
+	waitFor(mock.t, "websocket connection", func() bool {
+		mock.mutex.Lock()
+		defer mock.mutex.Unlock()
+		return len(mock.conns) > 0
+	})
+}
+
+// Drops all websocket connections without a close frame, like a server
+// that went away
+func (mock *mockSnapserver) disconnect() {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+	for _, conn := range mock.conns {
+		conn.NetConn().Close()
+	}
+	mock.conns = nil
+}
+
+// Returns the number of websocket connections accepted so far
+func (mock *mockSnapserver) connections() int {
+	mock.mutex.Lock()
+	defer mock.mutex.Unlock()
+	return mock.accepted
+}
+
+func (mock *mockSnapserver) close() {
+	mock.mutex.Lock()
+	for _, conn := range mock.conns {
+		conn.Close()
+	}
+	mock.mutex.Unlock()
+	mock.server.Close()
+}
+
+func (mock *mockSnapserver) handle(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			mock.t.Errorf("Websocket upgrade failed: %v", err)
+			return
+		}
+		mock.mutex.Lock()
+		mock.conns = append(mock.conns, conn)
+		mock.accepted++
+		mock.mutex.Unlock()
+		return
+	}
+
+	var req struct {
+		mockRequest
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mock.mutex.Lock()
+	mock.requests = append(mock.requests, req.mockRequest)
+	var result any
+	switch req.Method {
+	case "Server.GetStatus", "Group.SetClients":
+		result = mock.status
+	case "Group.SetStream":
+		result = map[string]any{"stream_id": req.Params["stream_id"]}
+	case "Stream.AddStream":
+		result = map[string]any{"stream_id": "added"}
+	default:
+		result = "ok"
+	}
+	mock.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result})
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,7 +1,10 @@
 package lib
 
 import (
+	"errors"
 	"log/slog"
+	"net/url"
+	"sort"
 
 	"github.com/ConnorsApps/snapcast-go/snapcast"
 )
@@ -12,23 +15,103 @@ type SnapcastServer struct {
 	Clients map[string]SnapcastClient `json:"clients"`
 }
 
+// snapcast/index
+type SnapcastIndex struct {
+	Groups  []string `json:"groups"`
+	Clients []string `json:"clients"`
+	Streams []string `json:"streams"`
+}
+
 // snapcast/client/id
 // Client.GetStatus
 type SnapcastClient struct {
 	ClientID  string  `json:"client_id"`
 	Host      string  `json:"host"`
+	Name      string  `json:"name"`
 	GroupID   string  `json:"group_id"`
 	GroupName string  `json:"group_name"`
 	StreamID  string  `json:"stream_id"`
 	Connected bool    `json:"connected"` // true, false
 	Volume    float64 `json:"volume"`
-	Muted     bool    `json:"muted"` // true, false
+	Muted     bool    `json:"muted"`   // true, false
+	Latency   int     `json:"latency"` // ms
 }
 
 // snapcast/stream/id
 type SnapcastStream struct {
-	StreamID string `json:"stream_id"`
-	Status   string `json:"status"` // playing, idle
+	StreamID   string                    `json:"stream_id"`
+	Status     string                    `json:"status"` // playing, idle
+	Properties *SnapcastStreamProperties `json:"properties,omitempty"`
+}
+
+// Stream properties of Snapcast 0.26+, only set for streams with a
+// controllable source such as librespot or MPD
+type SnapcastStreamProperties struct {
+	PlaybackStatus string         `json:"playbackStatus,omitempty"` // playing, paused, stopped
+	LoopStatus     string         `json:"loopStatus,omitempty"`     // none, track, playlist
+	Shuffle        *bool          `json:"shuffle,omitempty"`
+	Volume         *int           `json:"volume,omitempty"`
+	Mute           *bool          `json:"mute,omitempty"`
+	Rate           *float64       `json:"rate,omitempty"`
+	Position       *float64       `json:"position,omitempty"` // seconds
+	CanGoNext      bool           `json:"canGoNext"`
+	CanGoPrevious  bool           `json:"canGoPrevious"`
+	CanPlay        bool           `json:"canPlay"`
+	CanPause       bool           `json:"canPause"`
+	CanSeek        bool           `json:"canSeek"`
+	CanControl     bool           `json:"canControl"`
+	Metadata       map[string]any `json:"metadata,omitempty"`
+}
+
+// Payload of snapcast/streams/add, either a complete stream URI such as
+// pipe:///tmp/snapfifo?name=Doorbell or its parts
+type SnapcastStreamSpec struct {
+	URI    string            `json:"uri,omitempty"`
+	Scheme string            `json:"scheme,omitempty"` // pipe, librespot, airplay, file, process, tcp, ...
+	Host   string            `json:"host,omitempty"`
+	Path   string            `json:"path,omitempty"`
+	Name   string            `json:"name,omitempty"`
+	Query  map[string]string `json:"query,omitempty"` // sampleformat, codec, ...
+}
+
+// Returns the Snapcast stream URI of the spec
+func (spec SnapcastStreamSpec) StreamURI() (string, error) {
+	if spec.URI != "" {
+		return spec.URI, nil
+	}
+	if spec.Scheme == "" || spec.Name == "" {
+		return "", errors.New("stream spec needs an uri or a scheme and a name")
+	}
+	query := url.Values{}
+	for key, value := range spec.Query {
+		query.Set(key, value)
+	}
+	query.Set("name", spec.Name)
+	uri := url.URL{
+		Scheme:   spec.Scheme,
+		Host:     spec.Host,
+		Path:     spec.Path,
+		RawQuery: query.Encode(),
+	}
+	return uri.String(), nil
+}
+
+// The streams of a Server.GetStatus result, as snapcast.Stream lacks the
+// stream properties
+type serverStreamsResponse struct {
+	Server struct {
+		Streams []struct {
+			ID         string                    `json:"id"`
+			Properties *SnapcastStreamProperties `json:"properties"`
+		} `json:"streams"`
+	} `json:"server"`
+}
+
+// Params of Stream.OnProperties, as snapcast.StreamOnProperties lacks the
+// properties
+type streamOnProperties struct {
+	ID         string                    `json:"id"`
+	Properties *SnapcastStreamProperties `json:"properties"`
 }
 
 // snapcast/group/id
@@ -45,12 +128,14 @@ func parseClientStatus(c *snapcast.Client, g *snapcast.Group) (*SnapcastClient,
 	client := &SnapcastClient{
 		ClientID:  c.ID,
 		Host:      c.Host.Name,
+		Name:      c.Config.Name,
 		Connected: c.Connected,
 		GroupID:   g.ID,
 		GroupName: g.Name,
 		StreamID:  g.StreamID,
 		Muted:     c.Config.Volume.Muted,
 		Volume:    float64(c.Config.Volume.Percent),
+		Latency:   c.Config.Latency,
 	}
 	return client, nil
 }
@@ -77,6 +162,16 @@ func parseGroupStatus(g *snapcast.Group) (*SnapcastGroup, error) {
 	return group, nil
 }
 
+func parseStreamProperties(data *serverStreamsResponse) map[string]*SnapcastStreamProperties {
+	properties := make(map[string]*SnapcastStreamProperties)
+	for _, stream := range data.Server.Streams {
+		if stream.Properties != nil {
+			properties[stream.ID] = stream.Properties
+		}
+	}
+	return properties
+}
+
 func parseServerStatus(data *snapcast.ServerGetStatusResponse) (*SnapcastServer, error) {
 
 	allClients := make(map[string]SnapcastClient)
@@ -132,3 +227,90 @@ func snapcastGroupsEqual(g1, g2 SnapcastGroup) bool {
 
 	return true
 }
+
+// Returns the sorted ids of all groups, clients and streams
+func (server SnapcastServer) Index() SnapcastIndex {
+	return SnapcastIndex{
+		Groups:  sortedKeys(server.Groups),
+		Clients: sortedKeys(server.Clients),
+		Streams: sortedKeys(server.Streams),
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns the sorted keys of old that are not in current
+func removedKeys[V any](old, current map[string]V) []string {
+	removed := []string{}
+	for _, key := range sortedKeys(old) {
+		if _, exists := current[key]; !exists {
+			removed = append(removed, key)
+		}
+	}
+	return removed
+}
+
+// Updates the client fields that a client notification carries
+func updateClient(client *SnapcastClient, c *snapcast.Client) {
+	if c == nil {
+		return
+	}
+	client.Host = c.Host.Name
+	client.Name = c.Config.Name
+	client.Muted = c.Config.Volume.Muted
+	client.Volume = float64(c.Config.Volume.Percent)
+	client.Latency = c.Config.Latency
+}
+
+// Applies update to a client, both in the clients map and in the clients of
+// its group. Returns false if the client or its group is unknown.
+func (server *SnapcastServer) updateClient(clientID string, update func(*SnapcastClient)) (SnapcastClient, SnapcastGroup, bool) {
+	client, exists := server.Clients[clientID]
+	if !exists {
+		return SnapcastClient{}, SnapcastGroup{}, false
+	}
+	group, exists := server.Groups[client.GroupID]
+	if !exists {
+		return SnapcastClient{}, SnapcastGroup{}, false
+	}
+	update(&client)
+	server.Clients[clientID] = client
+	group.Clients[clientID] = client
+	return client, group, true
+}
+
+// Applies update to a group and propagates the group name and stream to its
+// clients. Returns false if the group is unknown.
+func (server *SnapcastServer) updateGroup(groupID string, update func(*SnapcastGroup)) (SnapcastGroup, bool) {
+	group, exists := server.Groups[groupID]
+	if !exists {
+		return SnapcastGroup{}, false
+	}
+	update(&group)
+	for clientID, client := range group.Clients {
+		client.GroupName = group.GroupName
+		client.StreamID = group.StreamID
+		group.Clients[clientID] = client
+		server.Clients[clientID] = client
+	}
+	server.Groups[groupID] = group
+	return group, true
+}
+
+// Applies update to a stream. Returns false if the stream is unknown.
+func (server *SnapcastServer) updateStream(streamID string, update func(*SnapcastStream)) (SnapcastStream, bool) {
+	stream, exists := server.Streams[streamID]
+	if !exists {
+		return SnapcastStream{}, false
+	}
+	update(&stream)
+	server.Streams[streamID] = stream
+	return stream, true
+}
@@ -0,0 +1,150 @@
+package lib
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRemovedKeys(t *testing.T) {
+	old := map[string]SnapcastStream{"a": {}, "b": {}, "c": {}}
+	current := map[string]SnapcastStream{"b": {}, "d": {}}
+
+	removed := removedKeys(old, current)
+	if !reflect.DeepEqual(removed, []string{"a", "c"}) {
+		t.Errorf("Unexpected removed keys %v", removed)
+	}
+	removed = removedKeys(nil, current)
+	if len(removed) != 0 {
+		t.Errorf("Expected no removed keys from empty map, got %v", removed)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	server := SnapcastServer{
+		Groups:  map[string]SnapcastGroup{"g2": {}, "g1": {}},
+		Clients: map[string]SnapcastClient{"c1": {}},
+	}
+	expected := SnapcastIndex{
+		Groups:  []string{"g1", "g2"},
+		Clients: []string{"c1"},
+		Streams: []string{},
+	}
+	if index := server.Index(); !reflect.DeepEqual(index, expected) {
+		t.Errorf("Unexpected index %v, expected %v", index, expected)
+	}
+}
+
+func TestParseStreamProperties(t *testing.T) {
+	raw := `{"server": {"streams": [
+		{"id": "Spotify", "status": "playing", "properties": {
+			"playbackStatus": "playing", "canControl": true, "canGoNext": true, "position": 12.5,
+			"metadata": {"title": "Song", "artist": ["Artist"], "duration": 180.0}}},
+		{"id": "Pipe", "status": "idle"}]}}`
+
+	var data serverStreamsResponse
+	err := json.Unmarshal([]byte(raw), &data)
+	if err != nil {
+		t.Fatalf("Could not unmarshal server status: %v", err)
+	}
+	properties := parseStreamProperties(&data)
+	if len(properties) != 1 {
+		t.Fatalf("Expected properties for one stream, got %v", properties)
+	}
+	spotify := properties["Spotify"]
+	if spotify == nil || spotify.PlaybackStatus != "playing" || !spotify.CanControl || !spotify.CanGoNext || spotify.CanSeek {
+		t.Errorf("Unexpected properties %+v", spotify)
+	}
+	if spotify.Position == nil || *spotify.Position != 12.5 {
+		t.Errorf("Unexpected position %v", spotify.Position)
+	}
+	if spotify.Metadata["title"] != "Song" || !reflect.DeepEqual(spotify.Metadata["artist"], []any{"Artist"}) {
+		t.Errorf("Unexpected metadata %v", spotify.Metadata)
+	}
+}
+
+func testServer() SnapcastServer {
+	c1 := SnapcastClient{ClientID: "c1", GroupID: "g1", GroupName: "Kitchen", StreamID: "s1", Volume: 50}
+	c2 := SnapcastClient{ClientID: "c2", GroupID: "g1", GroupName: "Kitchen", StreamID: "s1", Volume: 20}
+	return SnapcastServer{
+		Groups: map[string]SnapcastGroup{
+			"g1": {GroupID: "g1", GroupName: "Kitchen", StreamID: "s1",
+				Clients: map[string]SnapcastClient{"c1": c1, "c2": c2}},
+		},
+		Clients: map[string]SnapcastClient{"c1": c1, "c2": c2},
+		Streams: map[string]SnapcastStream{"s1": {StreamID: "s1", Status: "idle"}},
+	}
+}
+
+func TestUpdateClient(t *testing.T) {
+	server := testServer()
+
+	client, group, ok := server.updateClient("c1", func(c *SnapcastClient) { c.Volume = 75 })
+	if !ok || client.Volume != 75 || group.GroupID != "g1" {
+		t.Fatalf("Unexpected update result %v %v %v", client, group, ok)
+	}
+	if server.Clients["c1"].Volume != 75 || server.Groups["g1"].Clients["c1"].Volume != 75 {
+		t.Errorf("Client volume not updated in both maps")
+	}
+	if server.Clients["c2"].Volume != 20 {
+		t.Errorf("Other client updated")
+	}
+	if _, _, ok := server.updateClient("unknown", func(c *SnapcastClient) {}); ok {
+		t.Errorf("Expected update of unknown client to fail")
+	}
+}
+
+func TestUpdateGroup(t *testing.T) {
+	server := testServer()
+
+	group, ok := server.updateGroup("g1", func(g *SnapcastGroup) {
+		g.StreamID = "s2"
+		g.GroupName = "Living room"
+	})
+	if !ok || group.StreamID != "s2" {
+		t.Fatalf("Unexpected update result %v %v", group, ok)
+	}
+	for _, clientID := range []string{"c1", "c2"} {
+		for _, client := range []SnapcastClient{server.Clients[clientID], server.Groups["g1"].Clients[clientID]} {
+			if client.StreamID != "s2" || client.GroupName != "Living room" {
+				t.Errorf("Group change not propagated to client %v", client)
+			}
+		}
+	}
+	if _, ok := server.updateGroup("unknown", func(g *SnapcastGroup) {}); ok {
+		t.Errorf("Expected update of unknown group to fail")
+	}
+}
+
+func TestUpdateStream(t *testing.T) {
+	server := testServer()
+
+	stream, ok := server.updateStream("s1", func(s *SnapcastStream) { s.Status = "playing" })
+	if !ok || stream.Status != "playing" || server.Streams["s1"].Status != "playing" {
+		t.Errorf("Unexpected update result %v %v", stream, ok)
+	}
+	if _, ok := server.updateStream("unknown", func(s *SnapcastStream) {}); ok {
+		t.Errorf("Expected update of unknown stream to fail")
+	}
+}
+
+func TestStreamURI(t *testing.T) {
+	tests := []struct {
+		spec     SnapcastStreamSpec
+		expected string
+	}{
+		{SnapcastStreamSpec{URI: "pipe:///tmp/fifo?name=Raw"}, "pipe:///tmp/fifo?name=Raw"},
+		{SnapcastStreamSpec{Scheme: "pipe", Path: "/tmp/doorbell", Name: "Doorbell"}, "pipe:///tmp/doorbell?name=Doorbell"},
+		{SnapcastStreamSpec{Scheme: "tcp", Host: "127.0.0.1:4953", Name: "TCP", Query: map[string]string{"mode": "server"}},
+			"tcp://127.0.0.1:4953?mode=server&name=TCP"},
+	}
+	for _, tt := range tests {
+		uri, err := tt.spec.StreamURI()
+		if err != nil || uri != tt.expected {
+			t.Errorf("StreamURI(%+v) = %q, %v, expected %q", tt.spec, uri, err, tt.expected)
+		}
+	}
+	if _, err := (SnapcastStreamSpec{Scheme: "pipe", Path: "/tmp/x"}).StreamURI(); err == nil {
+		t.Errorf("Expected error for stream spec without name")
+	}
+}
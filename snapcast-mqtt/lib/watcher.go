@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/ConnorsApps/snapcast-go/snapcast"
+	"github.com/gorilla/websocket"
+)
+
+// SnapcastWatcher reads notifications from the Snapcast server websocket.
+// Unlike snapclient.Client.Listen its reader stops on the first read
+// error, which gorilla/websocket treats as permanent, and on Close, so no
+// goroutine outlives the connection.
+type SnapcastWatcher struct {
+	Notification chan *snapcast.Notification
+	Error        chan error
+
+	conn      *websocket.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+const dialTimeout = 10 * time.Second
+
+func NewSnapcastWatcher(config SnapClientConfig) (*SnapcastWatcher, error) {
+	u := url.URL{Scheme: "ws", Host: config.SnapServerAddress, Path: "/jsonrpc"}
+	dialer := websocket.Dialer{HandshakeTimeout: dialTimeout}
+	conn, _, err := dialer.Dial(u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	w := &SnapcastWatcher{
+		Notification: make(chan *snapcast.Notification),
+		Error:        make(chan error),
+		conn:         conn,
+		done:         make(chan struct{}),
+	}
+	go w.watch()
+	return w, nil
+}
+
+func (w *SnapcastWatcher) watch() {
+	for {
+		_, raw, err := w.conn.ReadMessage()
+		if err != nil {
+			select {
+			case w.Error <- err:
+			case <-w.done:
+			}
+			return
+		}
+
+		var msg snapcast.Notification
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			slog.Debug("Could not parse Snapcast message", "error", err, "message", string(raw))
+			continue
+		}
+		// Only notifications are sent on the websocket, requests use HTTP
+		if msg.Method == nil || msg.Params == nil {
+			continue
+		}
+		select {
+		case w.Notification <- &msg:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *SnapcastWatcher) Close() error {
+	var err error
+	w.closeOnce.Do(func() {
+		close(w.done)
+		// Best effort, the connection may already be broken
+		w.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		err = w.conn.Close()
+	})
+	return err
+}
+
+// Decodes the params of a notification
+func parseNotification[T any](msg *snapcast.Notification) (*T, error) {
+	return snapcast.ParseResult[T](msg.Params)
+}
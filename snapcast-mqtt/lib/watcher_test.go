@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestWatcherNotification(t *testing.T) {
+	mock := newMockSnapserver(t, testServerStatus)
+	watcher, err := NewSnapcastWatcher(SnapClientConfig{SnapServerAddress: mock.address()})
+	if err != nil {
+		t.Fatalf("Could not create watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	mock.waitConnected()
+	mock.notify("Group.OnMute", map[string]any{"id": "g1", "mute": true})
+	msg := <-watcher.Notification
+	if *msg.Method != "Group.OnMute" {
+		t.Fatalf("Unexpected notification %s", *msg.Method)
+	}
+	m, err := parseNotification[struct {
+		ID   string `json:"id"`
+		Mute bool   `json:"mute"`
+	}](msg)
+	if err != nil || m.ID != "g1" || !m.Mute {
+		t.Errorf("Unexpected params %+v: %v", m, err)
+	}
+}
+
+func TestWatcherStopsOnLostConnection(t *testing.T) {
+	mock := newMockSnapserver(t, testServerStatus)
+	goroutines := runtime.NumGoroutine()
+
+	watcher, err := NewSnapcastWatcher(SnapClientConfig{SnapServerAddress: mock.address()})
+	if err != nil {
+		t.Fatalf("Could not create watcher: %v", err)
+	}
+	mock.waitConnected()
+	mock.disconnect()
+	if err := <-watcher.Error; err == nil {
+		t.Error("Expected an error for the lost connection")
+	}
+	waitFor(t, "reader to stop", func() bool { return runtime.NumGoroutine() <= goroutines })
+
+	// Closing without reading the error stops the reader too
+	watcher, err = NewSnapcastWatcher(SnapClientConfig{SnapServerAddress: mock.address()})
+	if err != nil {
+		t.Fatalf("Could not create watcher: %v", err)
+	}
+	mock.waitConnected()
+	mock.disconnect()
+	watcher.Close()
+	waitFor(t, "reader to stop", func() bool { return runtime.NumGoroutine() <= goroutines })
+}
@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/claes/mqtt-bridges/snapcast-mqtt/lib"
 
@@ -25,6 +26,7 @@ func main() {
 	snapServerAddress := flag.String("address", "", "Snapcast server address:port")
 	topicPrefix := flag.String("topicPrefix", "", "MQTT topic prefix to use")
 	mqttBroker := flag.String("broker", "tcp://localhost:1883", "MQTT broker URL")
+	refreshInterval := flag.Int("refresh-interval", 300, "Seconds between full status refreshes, 0 to disable")
 	help := flag.Bool("help", false, "Print help")
 	debug = flag.Bool("debug", false, "Debug logging")
 	flag.Parse()
@@ -34,7 +36,10 @@ func main() {
 		os.Exit(0)
 	}
 
-	snapClientConfig := lib.SnapClientConfig{SnapServerAddress: *snapServerAddress}
+	snapClientConfig := lib.SnapClientConfig{
+		SnapServerAddress: *snapServerAddress,
+		RefreshInterval:   time.Duration(*refreshInterval) * time.Second,
+	}
 
 	mqttClient, err := common.CreateMQTTClient(*mqttBroker)
 	if err != nil {
@@ -54,10 +59,11 @@ func main() {
 
 	fmt.Printf("Started\n")
 
-	ctx := context.TODO()
+	ctx, cancel := context.WithCancel(context.Background())
 	go bridge.EventLoop(ctx)
 	<-c
-	bridge.SnapClient.Close()
+	cancel()
+	bridge.Close()
 	fmt.Printf("Shut down\n")
 
 	os.Exit(0)